@@ -1,3 +1,9 @@
 package dyscordconfig
 
 const TABLENAME = "DYSCORD_TABLE"
+const CONNECTIONS_TABLENAME = "DYSCORD_CONNECTIONS_TABLE"
+const MESSAGES_TABLENAME = "DYSCORD_MESSAGES_TABLE"
+const THREAD_INDEXNAME = "thread_index"
+const RECEIPTS_TABLENAME = "DYSCORD_RECEIPTS_TABLE"
+const USER_INDEXNAME = "user_index"
+const SEARCH_TABLENAME = "DYSCORD_SEARCH_TABLE"
@@ -8,11 +8,14 @@ import (
 
 	"github.com/aws/aws-cdk-go/awscdk/v2"
 	apigw "github.com/aws/aws-cdk-go/awscdk/v2/awsapigatewayv2"
+	apigw_authorizers "github.com/aws/aws-cdk-go/awscdk/v2/awsapigatewayv2authorizers"
 	apigw_integrations "github.com/aws/aws-cdk-go/awscdk/v2/awsapigatewayv2integrations"
 	dynamodb "github.com/aws/aws-cdk-go/awscdk/v2/awsdynamodb"
 	lambda "github.com/aws/aws-cdk-go/awscdk/v2/awslambda"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awslambdaeventsources"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awslogs"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awss3"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awssqs"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/constructs-go/constructs/v10"
 	"github.com/aws/jsii-runtime-go"
@@ -39,7 +42,110 @@ func NewDyscordBackendStack(scope constructs.Construct, id string, props *Dyscor
 		},
 		BillingMode:         dynamodb.BillingMode_PAY_PER_REQUEST,
 		TimeToLiveAttribute: jsii.String("ttl"),
-		Stream:              dynamodb.StreamViewType_NEW_IMAGE,
+		Stream:              dynamodb.StreamViewType_NEW_AND_OLD_IMAGES,
+	})
+
+	connectionsDatabase := dynamodb.NewTable(stack, jsii.String("DyscordConnectionsDB"), &dynamodb.TableProps{
+		TableName: jsii.String(dyscordconfig.CONNECTIONS_TABLENAME),
+		PartitionKey: &dynamodb.Attribute{
+			Name: jsii.String("connection_id"),
+			Type: dynamodb.AttributeType_STRING,
+		},
+		BillingMode:         dynamodb.BillingMode_PAY_PER_REQUEST,
+		TimeToLiveAttribute: jsii.String("ttl"),
+	})
+
+	connectionsDatabase.AddGlobalSecondaryIndex(&dynamodb.GlobalSecondaryIndexProps{
+		IndexName: jsii.String(dyscordconfig.USER_INDEXNAME),
+		PartitionKey: &dynamodb.Attribute{
+			Name: jsii.String("user_id"),
+			Type: dynamodb.AttributeType_STRING,
+		},
+		ProjectionType: dynamodb.ProjectionType_KEYS_ONLY,
+	})
+
+	messagesDatabase := dynamodb.NewTable(stack, jsii.String("DyscordMessagesDB"), &dynamodb.TableProps{
+		TableName: jsii.String(dyscordconfig.MESSAGES_TABLENAME),
+		PartitionKey: &dynamodb.Attribute{
+			Name: jsii.String("call_id"),
+			Type: dynamodb.AttributeType_STRING,
+		},
+		SortKey: &dynamodb.Attribute{
+			Name: jsii.String("message_id"),
+			Type: dynamodb.AttributeType_STRING,
+		},
+		BillingMode:         dynamodb.BillingMode_PAY_PER_REQUEST,
+		TimeToLiveAttribute: jsii.String("ttl"),
+	})
+
+	messagesDatabase.AddGlobalSecondaryIndex(&dynamodb.GlobalSecondaryIndexProps{
+		IndexName: jsii.String(dyscordconfig.THREAD_INDEXNAME),
+		PartitionKey: &dynamodb.Attribute{
+			Name: jsii.String("parent_id"),
+			Type: dynamodb.AttributeType_STRING,
+		},
+		SortKey: &dynamodb.Attribute{
+			Name: jsii.String("message_id"),
+			Type: dynamodb.AttributeType_STRING,
+		},
+		ProjectionType: dynamodb.ProjectionType_ALL,
+	})
+
+	receiptsDatabase := dynamodb.NewTable(stack, jsii.String("DyscordReceiptsDB"), &dynamodb.TableProps{
+		TableName: jsii.String(dyscordconfig.RECEIPTS_TABLENAME),
+		PartitionKey: &dynamodb.Attribute{
+			Name: jsii.String("principal"),
+			Type: dynamodb.AttributeType_STRING,
+		},
+		SortKey: &dynamodb.Attribute{
+			Name: jsii.String("call_id"),
+			Type: dynamodb.AttributeType_STRING,
+		},
+		BillingMode:         dynamodb.BillingMode_PAY_PER_REQUEST,
+		TimeToLiveAttribute: jsii.String("ttl"),
+	})
+
+	searchDatabase := dynamodb.NewTable(stack, jsii.String("DyscordSearchDB"), &dynamodb.TableProps{
+		TableName: jsii.String(dyscordconfig.SEARCH_TABLENAME),
+		PartitionKey: &dynamodb.Attribute{
+			Name: jsii.String("term"),
+			Type: dynamodb.AttributeType_STRING,
+		},
+		SortKey: &dynamodb.Attribute{
+			Name: jsii.String("message_id"),
+			Type: dynamodb.AttributeType_STRING,
+		},
+		BillingMode:         dynamodb.BillingMode_PAY_PER_REQUEST,
+		TimeToLiveAttribute: jsii.String("ttl"),
+	})
+
+	// attachments live only as long as the calls they were shared in
+	uploadsBucket := awss3.NewBucket(stack, jsii.String("DyscordUploads"), &awss3.BucketProps{
+		BlockPublicAccess: awss3.BlockPublicAccess_BLOCK_ALL(),
+		Encryption:        awss3.BucketEncryption_S3_MANAGED,
+		EnforceSSL:        jsii.Bool(true),
+		Cors: &[]*awss3.CorsRule{
+			{
+				AllowedMethods: &[]awss3.HttpMethods{awss3.HttpMethods_PUT, awss3.HttpMethods_GET},
+				AllowedOrigins: jsii.Strings("*"),
+				AllowedHeaders: jsii.Strings("*"),
+			},
+		},
+		LifecycleRules: &[]*awss3.LifecycleRule{
+			{
+				Prefix:                              jsii.String("uploads/"),
+				Expiration:                          awscdk.Duration_Days(jsii.Number(2)),
+				AbortIncompleteMultipartUploadAfter: awscdk.Duration_Days(jsii.Number(1)),
+			},
+		},
+	})
+
+	// stream batches the update handler gave up on, replayed with
+	// tools/replayUpdates
+	updatesDeadLetterQueue := awssqs.NewQueue(stack, jsii.String("DyscordUpdatesDLQ"), &awssqs.QueueProps{
+		RetentionPeriod: awscdk.Duration_Days(jsii.Number(14)),
+		Encryption:      awssqs.QueueEncryption_SQS_MANAGED,
+		EnforceSSL:      jsii.Bool(true),
 	})
 
 	updateHandler := lambda.NewFunction(stack, jsii.String("update"), &lambda.FunctionProps{
@@ -49,13 +155,29 @@ func NewDyscordBackendStack(scope constructs.Construct, id string, props *Dyscor
 		Architecture: lambda.Architecture_ARM_64(),
 		LogRetention: awslogs.RetentionDays_ONE_WEEK,
 		Events: &[]lambda.IEventSource{awslambdaeventsources.NewDynamoEventSource(database, &awslambdaeventsources.DynamoEventSourceProps{
-			StartingPosition: lambda.StartingPosition_LATEST,
+			StartingPosition:        lambda.StartingPosition_LATEST,
+			RetryAttempts:           jsii.Number(5),
+			BisectBatchOnError:      jsii.Bool(true),
+			ReportBatchItemFailures: jsii.Bool(true),
+			OnFailure:               awslambdaeventsources.NewSqsDlq(updatesDeadLetterQueue),
 		})},
 		Environment: &map[string]*string{
 			"AWS_ENDPOINT": aws.String(os.Getenv("AWS_ENDPOINT")),
 		},
 	})
 
+	authorizerHandler := lambda.NewFunction(stack, jsii.String("authorizer"), &lambda.FunctionProps{
+		Runtime:      lambda.Runtime_PROVIDED_AL2023(),
+		Handler:      jsii.String("bootstrap"),
+		Code:         lambda.Code_FromAsset(jsii.Sprintf("%v/lambdas/websocket/authorizer", dir), nil),
+		Architecture: lambda.Architecture_ARM_64(),
+		LogRetention: awslogs.RetentionDays_ONE_WEEK,
+		Environment: &map[string]*string{
+			"JWT_SECRET": aws.String(os.Getenv("JWT_SECRET")),
+			"JWKS_URL":   aws.String(os.Getenv("JWKS_URL")),
+		},
+	})
+
 	connectHandler := lambda.NewFunction(stack, jsii.String("connect"), &lambda.FunctionProps{
 		Runtime:      lambda.Runtime_PROVIDED_AL2023(),
 		Handler:      jsii.String("bootstrap"),
@@ -70,6 +192,9 @@ func NewDyscordBackendStack(scope constructs.Construct, id string, props *Dyscor
 		Code:         lambda.Code_FromAsset(jsii.Sprintf("%v/lambdas/websocket/disconnect", dir), nil),
 		Architecture: lambda.Architecture_ARM_64(),
 		LogRetention: awslogs.RetentionDays_ONE_WEEK,
+		Environment: &map[string]*string{
+			"AWS_ENDPOINT": aws.String(os.Getenv("AWS_ENDPOINT")),
+		},
 	})
 
 	defaultHandler := lambda.NewFunction(stack, jsii.String("default"), &lambda.FunctionProps{
@@ -96,6 +221,17 @@ func NewDyscordBackendStack(scope constructs.Construct, id string, props *Dyscor
 		LogRetention: awslogs.RetentionDays_ONE_WEEK,
 	})
 
+	iceCandidateHandler := lambda.NewFunction(stack, jsii.String("iceCandidate"), &lambda.FunctionProps{
+		Runtime:      lambda.Runtime_PROVIDED_AL2023(),
+		Handler:      jsii.String("bootstrap"),
+		Code:         lambda.Code_FromAsset(jsii.Sprintf("%v/lambdas/websocket/iceCandidate", dir), nil),
+		Architecture: lambda.Architecture_ARM_64(),
+		LogRetention: awslogs.RetentionDays_ONE_WEEK,
+		Environment: &map[string]*string{
+			"AWS_ENDPOINT": aws.String(os.Getenv("AWS_ENDPOINT")),
+		},
+	})
+
 	leaveCallHandler := lambda.NewFunction(stack, jsii.String("leaveCall"), &lambda.FunctionProps{
 		Runtime:      lambda.Runtime_PROVIDED_AL2023(),
 		Handler:      jsii.String("bootstrap"),
@@ -110,6 +246,158 @@ func NewDyscordBackendStack(scope constructs.Construct, id string, props *Dyscor
 		Code:         lambda.Code_FromAsset(jsii.Sprintf("%v/lambdas/websocket/sendMessage", dir), nil),
 		Architecture: lambda.Architecture_ARM_64(),
 		LogRetention: awslogs.RetentionDays_ONE_WEEK,
+		Environment: &map[string]*string{
+			"AWS_ENDPOINT":  aws.String(os.Getenv("AWS_ENDPOINT")),
+			"UPLOAD_BUCKET": uploadsBucket.BucketName(),
+		},
+	})
+
+	signalHandler := lambda.NewFunction(stack, jsii.String("signal"), &lambda.FunctionProps{
+		Runtime:      lambda.Runtime_PROVIDED_AL2023(),
+		Handler:      jsii.String("bootstrap"),
+		Code:         lambda.Code_FromAsset(jsii.Sprintf("%v/lambdas/websocket/signal", dir), nil),
+		Architecture: lambda.Architecture_ARM_64(),
+		LogRetention: awslogs.RetentionDays_ONE_WEEK,
+		Environment: &map[string]*string{
+			"AWS_ENDPOINT": aws.String(os.Getenv("AWS_ENDPOINT")),
+		},
+	})
+
+	renegotiateHandler := lambda.NewFunction(stack, jsii.String("renegotiate"), &lambda.FunctionProps{
+		Runtime:      lambda.Runtime_PROVIDED_AL2023(),
+		Handler:      jsii.String("bootstrap"),
+		Code:         lambda.Code_FromAsset(jsii.Sprintf("%v/lambdas/websocket/renegotiate", dir), nil),
+		Architecture: lambda.Architecture_ARM_64(),
+		LogRetention: awslogs.RetentionDays_ONE_WEEK,
+	})
+
+	getMessagesHandler := lambda.NewFunction(stack, jsii.String("getMessages"), &lambda.FunctionProps{
+		Runtime:      lambda.Runtime_PROVIDED_AL2023(),
+		Handler:      jsii.String("bootstrap"),
+		Code:         lambda.Code_FromAsset(jsii.Sprintf("%v/lambdas/websocket/getMessages", dir), nil),
+		Architecture: lambda.Architecture_ARM_64(),
+		LogRetention: awslogs.RetentionDays_ONE_WEEK,
+		Environment: &map[string]*string{
+			"UPLOAD_BUCKET": uploadsBucket.BucketName(),
+		},
+	})
+
+	editMessageHandler := lambda.NewFunction(stack, jsii.String("editMessage"), &lambda.FunctionProps{
+		Runtime:      lambda.Runtime_PROVIDED_AL2023(),
+		Handler:      jsii.String("bootstrap"),
+		Code:         lambda.Code_FromAsset(jsii.Sprintf("%v/lambdas/websocket/editMessage", dir), nil),
+		Architecture: lambda.Architecture_ARM_64(),
+		LogRetention: awslogs.RetentionDays_ONE_WEEK,
+		Environment: &map[string]*string{
+			"AWS_ENDPOINT": aws.String(os.Getenv("AWS_ENDPOINT")),
+		},
+	})
+
+	deleteMessageHandler := lambda.NewFunction(stack, jsii.String("deleteMessage"), &lambda.FunctionProps{
+		Runtime:      lambda.Runtime_PROVIDED_AL2023(),
+		Handler:      jsii.String("bootstrap"),
+		Code:         lambda.Code_FromAsset(jsii.Sprintf("%v/lambdas/websocket/deleteMessage", dir), nil),
+		Architecture: lambda.Architecture_ARM_64(),
+		LogRetention: awslogs.RetentionDays_ONE_WEEK,
+		Environment: &map[string]*string{
+			"AWS_ENDPOINT": aws.String(os.Getenv("AWS_ENDPOINT")),
+		},
+	})
+
+	typingHandler := lambda.NewFunction(stack, jsii.String("typing"), &lambda.FunctionProps{
+		Runtime:      lambda.Runtime_PROVIDED_AL2023(),
+		Handler:      jsii.String("bootstrap"),
+		Code:         lambda.Code_FromAsset(jsii.Sprintf("%v/lambdas/websocket/typing", dir), nil),
+		Architecture: lambda.Architecture_ARM_64(),
+		LogRetention: awslogs.RetentionDays_ONE_WEEK,
+		Environment: &map[string]*string{
+			"AWS_ENDPOINT": aws.String(os.Getenv("AWS_ENDPOINT")),
+		},
+	})
+
+	addReactionHandler := lambda.NewFunction(stack, jsii.String("addReaction"), &lambda.FunctionProps{
+		Runtime:      lambda.Runtime_PROVIDED_AL2023(),
+		Handler:      jsii.String("bootstrap"),
+		Code:         lambda.Code_FromAsset(jsii.Sprintf("%v/lambdas/websocket/addReaction", dir), nil),
+		Architecture: lambda.Architecture_ARM_64(),
+		LogRetention: awslogs.RetentionDays_ONE_WEEK,
+		Environment: &map[string]*string{
+			"AWS_ENDPOINT": aws.String(os.Getenv("AWS_ENDPOINT")),
+		},
+	})
+
+	removeReactionHandler := lambda.NewFunction(stack, jsii.String("removeReaction"), &lambda.FunctionProps{
+		Runtime:      lambda.Runtime_PROVIDED_AL2023(),
+		Handler:      jsii.String("bootstrap"),
+		Code:         lambda.Code_FromAsset(jsii.Sprintf("%v/lambdas/websocket/removeReaction", dir), nil),
+		Architecture: lambda.Architecture_ARM_64(),
+		LogRetention: awslogs.RetentionDays_ONE_WEEK,
+		Environment: &map[string]*string{
+			"AWS_ENDPOINT": aws.String(os.Getenv("AWS_ENDPOINT")),
+		},
+	})
+
+	getThreadHandler := lambda.NewFunction(stack, jsii.String("getThread"), &lambda.FunctionProps{
+		Runtime:      lambda.Runtime_PROVIDED_AL2023(),
+		Handler:      jsii.String("bootstrap"),
+		Code:         lambda.Code_FromAsset(jsii.Sprintf("%v/lambdas/websocket/getThread", dir), nil),
+		Architecture: lambda.Architecture_ARM_64(),
+		LogRetention: awslogs.RetentionDays_ONE_WEEK,
+		Environment: &map[string]*string{
+			"UPLOAD_BUCKET": uploadsBucket.BucketName(),
+		},
+	})
+
+	ackMessagesHandler := lambda.NewFunction(stack, jsii.String("ackMessages"), &lambda.FunctionProps{
+		Runtime:      lambda.Runtime_PROVIDED_AL2023(),
+		Handler:      jsii.String("bootstrap"),
+		Code:         lambda.Code_FromAsset(jsii.Sprintf("%v/lambdas/websocket/ackMessages", dir), nil),
+		Architecture: lambda.Architecture_ARM_64(),
+		LogRetention: awslogs.RetentionDays_ONE_WEEK,
+		Environment: &map[string]*string{
+			"AWS_ENDPOINT": aws.String(os.Getenv("AWS_ENDPOINT")),
+		},
+	})
+
+	getUnreadCountsHandler := lambda.NewFunction(stack, jsii.String("getUnreadCounts"), &lambda.FunctionProps{
+		Runtime:      lambda.Runtime_PROVIDED_AL2023(),
+		Handler:      jsii.String("bootstrap"),
+		Code:         lambda.Code_FromAsset(jsii.Sprintf("%v/lambdas/websocket/getUnreadCounts", dir), nil),
+		Architecture: lambda.Architecture_ARM_64(),
+		LogRetention: awslogs.RetentionDays_ONE_WEEK,
+	})
+
+	requestUploadHandler := lambda.NewFunction(stack, jsii.String("requestUpload"), &lambda.FunctionProps{
+		Runtime:      lambda.Runtime_PROVIDED_AL2023(),
+		Handler:      jsii.String("bootstrap"),
+		Code:         lambda.Code_FromAsset(jsii.Sprintf("%v/lambdas/websocket/requestUpload", dir), nil),
+		Architecture: lambda.Architecture_ARM_64(),
+		LogRetention: awslogs.RetentionDays_ONE_WEEK,
+		Environment: &map[string]*string{
+			"UPLOAD_BUCKET": uploadsBucket.BucketName(),
+		},
+	})
+
+	searchMessagesHandler := lambda.NewFunction(stack, jsii.String("searchMessages"), &lambda.FunctionProps{
+		Runtime:      lambda.Runtime_PROVIDED_AL2023(),
+		Handler:      jsii.String("bootstrap"),
+		Code:         lambda.Code_FromAsset(jsii.Sprintf("%v/lambdas/websocket/searchMessages", dir), nil),
+		Architecture: lambda.Architecture_ARM_64(),
+		LogRetention: awslogs.RetentionDays_ONE_WEEK,
+		Environment: &map[string]*string{
+			"UPLOAD_BUCKET": uploadsBucket.BucketName(),
+		},
+	})
+
+	endCallHandler := lambda.NewFunction(stack, jsii.String("endCall"), &lambda.FunctionProps{
+		Runtime:      lambda.Runtime_PROVIDED_AL2023(),
+		Handler:      jsii.String("bootstrap"),
+		Code:         lambda.Code_FromAsset(jsii.Sprintf("%v/lambdas/websocket/endCall", dir), nil),
+		Architecture: lambda.Architecture_ARM_64(),
+		LogRetention: awslogs.RetentionDays_ONE_WEEK,
+		Environment: &map[string]*string{
+			"AWS_ENDPOINT": aws.String(os.Getenv("AWS_ENDPOINT")),
+		},
 	})
 
 	connectRequestTemplate, _ := json.Marshal(map[string]interface{}{
@@ -120,12 +408,16 @@ func NewDyscordBackendStack(scope constructs.Construct, id string, props *Dyscor
 	webSocketApi := apigw.NewWebSocketApi(stack, jsii.String("DyscordWSAPI"), &apigw.WebSocketApiProps{
 		ConnectRouteOptions: &apigw.WebSocketRouteOptions{
 			Integration: apigw_integrations.NewWebSocketLambdaIntegration(jsii.String("ConnectionIntegration"), connectHandler, nil),
+			Authorizer: apigw_authorizers.NewWebSocketLambdaAuthorizer(jsii.String("ConnectAuthorizer"), authorizerHandler, &apigw_authorizers.WebSocketLambdaAuthorizerProps{
+				IdentitySource: jsii.Strings("route.request.querystring.token"),
+			}),
 		},
 		DisconnectRouteOptions: &apigw.WebSocketRouteOptions{
 			Integration: apigw_integrations.NewWebSocketLambdaIntegration(jsii.String("DisconnectIntegration"), disconnectHandler, nil),
 		},
 		DefaultRouteOptions: &apigw.WebSocketRouteOptions{
-			Integration: apigw_integrations.NewWebSocketLambdaIntegration(jsii.String("DefaultIntegration"), defaultHandler, nil),
+			Integration:    apigw_integrations.NewWebSocketLambdaIntegration(jsii.String("DefaultIntegration"), defaultHandler, nil),
+			ReturnResponse: jsii.Bool(true),
 		},
 	})
 
@@ -149,16 +441,91 @@ func NewDyscordBackendStack(scope constructs.Construct, id string, props *Dyscor
 		ReturnResponse: jsii.Bool(true),
 	})
 
+	webSocketApi.AddRoute(jsii.String("iceCandidate"), &apigw.WebSocketRouteOptions{
+		Integration:    apigw_integrations.NewWebSocketLambdaIntegration(jsii.String("IceCandidate"), iceCandidateHandler, nil),
+		ReturnResponse: jsii.Bool(true),
+	})
+
+	webSocketApi.AddRoute(jsii.String("signal"), &apigw.WebSocketRouteOptions{
+		Integration:    apigw_integrations.NewWebSocketLambdaIntegration(jsii.String("Signal"), signalHandler, nil),
+		ReturnResponse: jsii.Bool(true),
+	})
+
+	webSocketApi.AddRoute(jsii.String("renegotiate"), &apigw.WebSocketRouteOptions{
+		Integration:    apigw_integrations.NewWebSocketLambdaIntegration(jsii.String("Renegotiate"), renegotiateHandler, nil),
+		ReturnResponse: jsii.Bool(true),
+	})
+
 	webSocketApi.AddRoute(jsii.String("sendMessage"), &apigw.WebSocketRouteOptions{
 		Integration:    apigw_integrations.NewWebSocketLambdaIntegration(jsii.String("SendMessage"), sendMessageHandler, nil),
 		ReturnResponse: jsii.Bool(true),
 	})
 
+	webSocketApi.AddRoute(jsii.String("getMessages"), &apigw.WebSocketRouteOptions{
+		Integration:    apigw_integrations.NewWebSocketLambdaIntegration(jsii.String("GetMessages"), getMessagesHandler, nil),
+		ReturnResponse: jsii.Bool(true),
+	})
+
+	webSocketApi.AddRoute(jsii.String("getThread"), &apigw.WebSocketRouteOptions{
+		Integration:    apigw_integrations.NewWebSocketLambdaIntegration(jsii.String("GetThread"), getThreadHandler, nil),
+		ReturnResponse: jsii.Bool(true),
+	})
+
+	webSocketApi.AddRoute(jsii.String("ackMessages"), &apigw.WebSocketRouteOptions{
+		Integration:    apigw_integrations.NewWebSocketLambdaIntegration(jsii.String("AckMessages"), ackMessagesHandler, nil),
+		ReturnResponse: jsii.Bool(true),
+	})
+
+	webSocketApi.AddRoute(jsii.String("getUnreadCounts"), &apigw.WebSocketRouteOptions{
+		Integration:    apigw_integrations.NewWebSocketLambdaIntegration(jsii.String("GetUnreadCounts"), getUnreadCountsHandler, nil),
+		ReturnResponse: jsii.Bool(true),
+	})
+
+	webSocketApi.AddRoute(jsii.String("requestUpload"), &apigw.WebSocketRouteOptions{
+		Integration:    apigw_integrations.NewWebSocketLambdaIntegration(jsii.String("RequestUpload"), requestUploadHandler, nil),
+		ReturnResponse: jsii.Bool(true),
+	})
+
+	webSocketApi.AddRoute(jsii.String("searchMessages"), &apigw.WebSocketRouteOptions{
+		Integration:    apigw_integrations.NewWebSocketLambdaIntegration(jsii.String("SearchMessages"), searchMessagesHandler, nil),
+		ReturnResponse: jsii.Bool(true),
+	})
+
+	webSocketApi.AddRoute(jsii.String("editMessage"), &apigw.WebSocketRouteOptions{
+		Integration:    apigw_integrations.NewWebSocketLambdaIntegration(jsii.String("EditMessage"), editMessageHandler, nil),
+		ReturnResponse: jsii.Bool(true),
+	})
+
+	webSocketApi.AddRoute(jsii.String("deleteMessage"), &apigw.WebSocketRouteOptions{
+		Integration:    apigw_integrations.NewWebSocketLambdaIntegration(jsii.String("DeleteMessage"), deleteMessageHandler, nil),
+		ReturnResponse: jsii.Bool(true),
+	})
+
+	webSocketApi.AddRoute(jsii.String("typing"), &apigw.WebSocketRouteOptions{
+		Integration:    apigw_integrations.NewWebSocketLambdaIntegration(jsii.String("Typing"), typingHandler, nil),
+		ReturnResponse: jsii.Bool(true),
+	})
+
+	webSocketApi.AddRoute(jsii.String("addReaction"), &apigw.WebSocketRouteOptions{
+		Integration:    apigw_integrations.NewWebSocketLambdaIntegration(jsii.String("AddReaction"), addReactionHandler, nil),
+		ReturnResponse: jsii.Bool(true),
+	})
+
+	webSocketApi.AddRoute(jsii.String("removeReaction"), &apigw.WebSocketRouteOptions{
+		Integration:    apigw_integrations.NewWebSocketLambdaIntegration(jsii.String("RemoveReaction"), removeReactionHandler, nil),
+		ReturnResponse: jsii.Bool(true),
+	})
+
 	webSocketApi.AddRoute(jsii.String("leaveCall"), &apigw.WebSocketRouteOptions{
 		Integration:    apigw_integrations.NewWebSocketLambdaIntegration(jsii.String("LeaveCall"), leaveCallHandler, nil),
 		ReturnResponse: jsii.Bool(true),
 	})
 
+	webSocketApi.AddRoute(jsii.String("endCall"), &apigw.WebSocketRouteOptions{
+		Integration:    apigw_integrations.NewWebSocketLambdaIntegration(jsii.String("EndCall"), endCallHandler, nil),
+		ReturnResponse: jsii.Bool(true),
+	})
+
 	gateway := apigw.NewWebSocketStage(stack, jsii.String("DyscordWS"), &apigw.WebSocketStageProps{
 		WebSocketApi: webSocketApi,
 		StageName:    jsii.String("dev"),
@@ -173,22 +540,59 @@ func NewDyscordBackendStack(scope constructs.Construct, id string, props *Dyscor
 		disconnectHandler,
 		defaultHandler,
 		joinCallHandler,
+		iceCandidateHandler,
 		createCallHandler,
 		sendMessageHandler,
 		leaveCallHandler,
+		signalHandler,
+		renegotiateHandler,
+		getMessagesHandler,
+		editMessageHandler,
+		deleteMessageHandler,
+		typingHandler,
+		addReactionHandler,
+		removeReactionHandler,
+		getThreadHandler,
+		ackMessagesHandler,
+		getUnreadCountsHandler,
+		requestUploadHandler,
+		searchMessagesHandler,
+		endCallHandler,
 	}
 
 	for _, f := range functions {
 		database.GrantReadWriteData(f)
+		connectionsDatabase.GrantReadWriteData(f)
+		messagesDatabase.GrantReadWriteData(f)
+		receiptsDatabase.GrantReadWriteData(f)
+		searchDatabase.GrantReadWriteData(f)
 	}
 
 	for _, f := range functions {
 		gateway.GrantManagementApiAccess(f)
 	}
 
+	// update looks up the codecs of the connections it pushes to, and evicts
+	// the ones it finds gone
+	database.GrantReadWriteData(updateHandler)
+	connectionsDatabase.GrantReadWriteData(updateHandler)
+
+	uploadsBucket.GrantPut(requestUploadHandler, nil)
+	uploadsBucket.GrantRead(sendMessageHandler, nil)
+	uploadsBucket.GrantRead(getMessagesHandler, nil)
+	uploadsBucket.GrantRead(getThreadHandler, nil)
+	uploadsBucket.GrantRead(searchMessagesHandler, nil)
+
 	database.GrantStreamRead(updateHandler)
 	gateway.GrantManagementApiAccess(updateHandler)
 
+	awscdk.NewCfnOutput(stack, jsii.String("UpdatesDeadLetterQueueUrl"), &awscdk.CfnOutputProps{
+		Value: updatesDeadLetterQueue.QueueUrl(),
+	})
+	awscdk.NewCfnOutput(stack, jsii.String("UpdateFunctionName"), &awscdk.CfnOutputProps{
+		Value: updateHandler.FunctionName(),
+	})
+
 	return stack
 }
 
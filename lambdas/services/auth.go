@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claims are the token claims the backend cares about. The subject is the
+// user id and Name is shown to the other participants of a call.
+type Claims struct {
+	jwt.RegisteredClaims
+	Name string `json:"name"`
+}
+
+// TokenValidator validates tokens signed with a shared HS256 Secret or with an
+// RS256 key published in the JWKS document at JWKSLocation, which is either an
+// http(s) URL or a path on disk.
+type TokenValidator struct {
+	Secret       []byte
+	JWKSLocation string
+
+	mutex    sync.Mutex
+	keys     map[string]*rsa.PublicKey
+	loadedAt time.Time
+}
+
+// jwksRefreshInterval is the least time between two loads of the JWKS, so
+// tokens with made up key ids cannot have every connection attempt fetch it.
+const jwksRefreshInterval = time.Minute
+
+func (v *TokenValidator) Validate(ctx context.Context, token string) (Claims, error) {
+	var claims Claims
+
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (any, error) {
+		switch t.Method.Alg() {
+		case jwt.SigningMethodHS256.Alg():
+			if len(v.Secret) == 0 {
+				return nil, fmt.Errorf("no secret configured for HS256 tokens")
+			}
+			return v.Secret, nil
+		case jwt.SigningMethodRS256.Alg():
+			kid, _ := t.Header["kid"].(string)
+			return v.publicKey(ctx, kid)
+		}
+		return nil, fmt.Errorf("unexpected signing method %v", t.Method.Alg())
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg(), jwt.SigningMethodRS256.Alg()}),
+		jwt.WithExpirationRequired(),
+	)
+
+	if err != nil {
+		return claims, err
+	}
+
+	if claims.Subject == "" {
+		return claims, fmt.Errorf("token has no subject")
+	}
+
+	return claims, nil
+}
+
+// publicKey looks a key up by id, reloading the JWKS when the id is unknown
+// so rotated keys are picked up without a cold start. The JWKS is reloaded at
+// most once every jwksRefreshInterval, failed loads included.
+func (v *TokenValidator) publicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if key, ok := v.lookup(kid); ok {
+		return key, nil
+	}
+
+	if v.JWKSLocation == "" {
+		return nil, fmt.Errorf("no JWKS configured for RS256 tokens")
+	}
+
+	if !v.loadedAt.IsZero() && time.Since(v.loadedAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("no key %q in JWKS", kid)
+	}
+
+	v.loadedAt = time.Now()
+	keys, err := LoadJWKS(ctx, v.JWKSLocation)
+	if err != nil {
+		return nil, err
+	}
+	v.keys = keys
+
+	if key, ok := v.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("no key %q in JWKS", kid)
+}
+
+// lookup finds a key of the loaded JWKS. Tokens without a kid are accepted
+// when the set holds a single key.
+func (v *TokenValidator) lookup(kid string) (*rsa.PublicKey, bool) {
+	if key, ok := v.keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// LoadJWKS reads the RSA signing keys of a JWKS document, keyed by key id.
+func LoadJWKS(ctx context.Context, location string) (map[string]*rsa.PublicKey, error) {
+	var document struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	var data []byte
+	var err error
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		data, err = fetch(ctx, location)
+	} else {
+		data, err = os.ReadFile(strings.TrimPrefix(location, "file://"))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, key := range document.Keys {
+		if key.Kty != "RSA" || (key.Use != "" && key.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, fmt.Errorf("key %q has an invalid modulus, %v", key.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, fmt.Errorf("key %q has an invalid exponent, %v", key.Kid, err)
+		}
+		keys[key.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return keys, nil
+}
+
+func fetch(ctx context.Context, url string) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not fetch %v, %v", url, response.Status)
+	}
+	return io.ReadAll(response.Body)
+}
+
+// CallerUser returns the user id and display name the $connect authorizer
+// attached to the caller's connection.
+func CallerUser(request events.APIGatewayWebsocketProxyRequest) (string, string) {
+	authorizer, ok := request.RequestContext.Authorizer.(map[string]any)
+	if !ok {
+		return "", ""
+	}
+	userId, _ := authorizer["user_id"].(string)
+	displayName, _ := authorizer["display_name"].(string)
+	return userId, displayName
+}
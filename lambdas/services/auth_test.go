@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var testSecret = []byte("test-secret")
+
+// jwksServer serves the public half of key under the kid "test" and counts
+// how often it was fetched.
+func jwksServer(t *testing.T, key *rsa.PrivateKey) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	fetches := &atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []jsonWebKey{{
+				Kty: "RSA",
+				Kid: "test",
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server, fetches
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key any, claims Claims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestTokenValidator(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, _ := jwksServer(t, rsaKey)
+
+	valid := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "user-1",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		Name: "Ada",
+	}
+	expired := valid
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+	noSubject := valid
+	noSubject.Subject = ""
+	noExpiry := valid
+	noExpiry.ExpiresAt = nil
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"hs256", sign(t, jwt.SigningMethodHS256, "", testSecret, valid), true},
+		{"rs256", sign(t, jwt.SigningMethodRS256, "test", rsaKey, valid), true},
+		{"rs256 without kid", sign(t, jwt.SigningMethodRS256, "", rsaKey, valid), true},
+		{"hs256 wrong secret", sign(t, jwt.SigningMethodHS256, "", []byte("other"), valid), false},
+		{"rs256 wrong key", sign(t, jwt.SigningMethodRS256, "test", otherKey, valid), false},
+		{"rs256 unknown kid", sign(t, jwt.SigningMethodRS256, "unknown", rsaKey, valid), false},
+		{"expired", sign(t, jwt.SigningMethodHS256, "", testSecret, expired), false},
+		{"no expiry", sign(t, jwt.SigningMethodHS256, "", testSecret, noExpiry), false},
+		{"no subject", sign(t, jwt.SigningMethodHS256, "", testSecret, noSubject), false},
+		{"hs512", sign(t, jwt.SigningMethodHS512, "", testSecret, valid), false},
+		{"none", sign(t, jwt.SigningMethodNone, "", jwt.UnsafeAllowNoneSignatureType, valid), false},
+		{"garbage", "not.a.token", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			validator := &TokenValidator{Secret: testSecret, JWKSLocation: server.URL}
+			claims, err := validator.Validate(context.Background(), test.token)
+
+			if test.ok && err != nil {
+				t.Fatalf("expected the token to be valid, %v", err)
+			}
+			if !test.ok && err == nil {
+				t.Fatalf("expected the token to be rejected")
+			}
+			if test.ok && (claims.Subject != "user-1" || claims.Name != "Ada") {
+				t.Fatalf("unexpected claims %+v", claims)
+			}
+		})
+	}
+}
+
+func TestTokenValidatorRS256WithoutJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := sign(t, jwt.SigningMethodRS256, "test", rsaKey, Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "user-1",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+
+	validator := &TokenValidator{Secret: testSecret}
+	if _, err := validator.Validate(context.Background(), token); err == nil {
+		t.Fatal("expected RS256 tokens to be rejected without a JWKS")
+	}
+}
+
+func TestTokenValidatorReloadsJWKSAtMostOncePerInterval(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, fetches := jwksServer(t, rsaKey)
+	validator := &TokenValidator{JWKSLocation: server.URL}
+
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "user-1",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+	for range 5 {
+		validator.Validate(context.Background(), sign(t, jwt.SigningMethodRS256, "unknown", rsaKey, claims))
+	}
+	if _, err := validator.Validate(context.Background(), sign(t, jwt.SigningMethodRS256, "test", rsaKey, claims)); err != nil {
+		t.Fatalf("expected a known kid to be served from the loaded keys, %v", err)
+	}
+
+	if count := fetches.Load(); count != 1 {
+		t.Fatalf("expected the JWKS to be fetched once, got %v", count)
+	}
+}
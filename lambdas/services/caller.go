@@ -0,0 +1,39 @@
+package services
+
+import (
+	"encoding/json"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// CallerConnectionId returns the connection that sent the request, as seen by
+// API Gateway. Bodies may still carry a connection_id for older clients, but a
+// body claiming any connection other than the caller's own is rejected.
+func CallerConnectionId(request events.APIGatewayWebsocketProxyRequest) (string, error) {
+	var claim struct {
+		ConnectionId string `json:"connection_id"`
+	}
+
+	connectionId := request.RequestContext.ConnectionID
+
+	if request.Body != "" {
+		if err := json.Unmarshal([]byte(request.Body), &claim); err != nil {
+			return connectionId, ErrInvalidBody
+		}
+	}
+
+	if claim.ConnectionId != "" && claim.ConnectionId != connectionId {
+		return connectionId, Errorf(Forbidden, "Connection %v cannot act as %v", connectionId, claim.ConnectionId)
+	}
+
+	return connectionId, nil
+}
+
+// Principal is who the caller acts as: their user when the connection was
+// authorized as one, otherwise the connection itself.
+func Principal(connectionId string, userId string) string {
+	if userId != "" {
+		return userId
+	}
+	return connectionId
+}
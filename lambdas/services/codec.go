@@ -0,0 +1,100 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec is the wire format a connection receives responses and pushes in,
+// picked with the protocol query parameter on $connect. Requests are always
+// JSON since API Gateway routes them by their action field.
+type Codec string
+
+const (
+	JSONCodec        Codec = "json"
+	MessagePackCodec Codec = "msgpack"
+)
+
+func ParseCodec(protocol string) (Codec, error) {
+	switch Codec(strings.ToLower(protocol)) {
+	case "", JSONCodec:
+		return JSONCodec, nil
+	case MessagePackCodec:
+		return MessagePackCodec, nil
+	}
+	return JSONCodec, Errorf(InvalidRequest, "Unsupported protocol %v", protocol)
+}
+
+// CallerCodec returns the codec the $connect authorizer recorded for the
+// caller's connection.
+func CallerCodec(request events.APIGatewayWebsocketProxyRequest) Codec {
+	authorizer, ok := request.RequestContext.Authorizer.(map[string]any)
+	if !ok {
+		return JSONCodec
+	}
+	protocol, _ := authorizer["codec"].(string)
+	codec, err := ParseCodec(protocol)
+	if err != nil {
+		return JSONCodec
+	}
+	return codec
+}
+
+func (codec Codec) ContentType() string {
+	if codec == MessagePackCodec {
+		return "application/msgpack"
+	}
+	return "application/json"
+}
+
+// Marshal encodes a value in the codec. MessagePack is encoded from the JSON
+// form of the value so both codecs carry the same fields under the same
+// names.
+func (codec Codec) Marshal(value any) ([]byte, error) {
+	data, err := json.Marshal(value)
+	if err != nil || codec != MessagePackCodec {
+		return data, err
+	}
+
+	var generic any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err = decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+	encoder := msgpack.NewEncoder(&buffer)
+	encoder.UseCompactInts(true)
+	encoder.UseCompactFloats(true)
+	if err = encoder.Encode(withNumbers(generic)); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// withNumbers turns the numbers of a decoded JSON value into integers where
+// they are whole, so they are not all sent as floats.
+func withNumbers(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		for key, item := range value {
+			value[key] = withNumbers(item)
+		}
+	case []any:
+		for index, item := range value {
+			value[index] = withNumbers(item)
+		}
+	case json.Number:
+		if integer, err := value.Int64(); err == nil {
+			return integer
+		}
+		float, _ := value.Float64()
+		return float
+	}
+	return value
+}
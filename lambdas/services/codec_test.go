@@ -0,0 +1,133 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestParseCodec(t *testing.T) {
+	tests := []struct {
+		protocol string
+		codec    Codec
+		ok       bool
+	}{
+		{"", JSONCodec, true},
+		{"json", JSONCodec, true},
+		{"JSON", JSONCodec, true},
+		{"msgpack", MessagePackCodec, true},
+		{"MsgPack", MessagePackCodec, true},
+		{"protobuf", JSONCodec, false},
+		{"msgpack.v2", JSONCodec, false},
+		{" json", JSONCodec, false},
+	}
+
+	for _, test := range tests {
+		codec, err := ParseCodec(test.protocol)
+		if codec != test.codec {
+			t.Errorf("ParseCodec(%q) = %v, expected %v", test.protocol, codec, test.codec)
+		}
+
+		var clientError *Error
+		if test.ok && err != nil {
+			t.Errorf("ParseCodec(%q) failed, %v", test.protocol, err)
+		}
+		if !test.ok && (!errors.As(err, &clientError) || clientError.Code != InvalidRequest) {
+			t.Errorf("ParseCodec(%q) = %v, expected invalid_request", test.protocol, err)
+		}
+	}
+}
+
+func TestCallerCodec(t *testing.T) {
+	tests := []struct {
+		name       string
+		authorizer any
+		codec      Codec
+	}{
+		{"no authorizer", nil, JSONCodec},
+		{"no codec", map[string]any{"principalId": "user-1"}, JSONCodec},
+		{"msgpack", map[string]any{"codec": "msgpack"}, MessagePackCodec},
+		{"unknown codec", map[string]any{"codec": "protobuf"}, JSONCodec},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := events.APIGatewayWebsocketProxyRequest{}
+			request.RequestContext.Authorizer = test.authorizer
+			if codec := CallerCodec(request); codec != test.codec {
+				t.Errorf("CallerCodec = %v, expected %v", codec, test.codec)
+			}
+		})
+	}
+}
+
+func TestCodecMarshal(t *testing.T) {
+	envelope := NewEnvelope("getMessages", map[string]any{
+		"call_id":  "aaaaaa",
+		"count":    3,
+		"ratio":    0.5,
+		"has_more": false,
+		"messages": []Message{{CallId: "aaaaaa", MessageId: "0123456789abcdef0123456789ab", Text: "hi"}},
+	})
+
+	jsonData, err := JSONCodec.Marshal(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fromJSON map[string]any
+	if err = json.Unmarshal(jsonData, &fromJSON); err != nil {
+		t.Fatalf("JSON did not round-trip, %v", err)
+	}
+
+	msgpackData, err := MessagePackCodec.Marshal(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fromMessagePack map[string]any
+	if err = msgpack.Unmarshal(msgpackData, &fromMessagePack); err != nil {
+		t.Fatalf("MessagePack did not round-trip, %v", err)
+	}
+
+	// both codecs carry the same fields under the same names
+	if !reflect.DeepEqual(normalize(t, fromJSON), normalize(t, fromMessagePack)) {
+		t.Fatalf("codecs disagree,\n%v\n%v", fromJSON, fromMessagePack)
+	}
+
+	data := fromMessagePack["data"].(map[string]any)
+	if _, ok := data["count"].(int8); !ok {
+		t.Errorf("expected whole numbers as compact integers, got %T", data["count"])
+	}
+	if data["ratio"] != 0.5 {
+		t.Errorf("expected fractions to stay floats, got %T %v", data["ratio"], data["ratio"])
+	}
+	if data["has_more"] != false {
+		t.Errorf("expected booleans to stay booleans, got %v", data["has_more"])
+	}
+}
+
+func TestCodecMarshalFailure(t *testing.T) {
+	for _, codec := range []Codec{JSONCodec, MessagePackCodec} {
+		if _, err := codec.Marshal(map[string]any{"channel": make(chan int)}); err == nil {
+			t.Errorf("expected %v to fail on values JSON cannot hold", codec)
+		}
+	}
+}
+
+// normalize turns the numbers of a decoded value into float64, the way JSON
+// decodes them, so both codecs can be compared.
+func normalize(t *testing.T, value any) any {
+	t.Helper()
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var normalized any
+	if err = json.Unmarshal(data, &normalized); err != nil {
+		t.Fatal(err)
+	}
+	return normalized
+}
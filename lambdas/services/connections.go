@@ -0,0 +1,253 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	dyscordconfig "dyscord-backend/config"
+)
+
+// TypingWindow is how long a typing event from a connection stands for the
+// ones that follow it in the same call.
+const TypingWindow = 3 * time.Second
+
+// Connection records an API Gateway connection and the calls it has joined,
+// so everything it left behind can be cleaned up when it disconnects.
+type Connection struct {
+	ConnectionId string   `dynamodbav:"connection_id" json:"connection_id"`
+	UserId       string   `dynamodbav:"user_id,omitempty" json:"user_id"`
+	DisplayName  string   `dynamodbav:"display_name" json:"display_name"`
+	CallIds      []string `dynamodbav:"call_ids,stringset,omitempty" json:"call_ids"`
+	Codec        Codec    `dynamodbav:"codec,omitempty" json:"codec"`
+	ConnectedAt  int64    `dynamodbav:"connected_at" json:"connected_at"`
+	TypingCallId string   `dynamodbav:"typing_call_id,omitempty" json:"-"`
+	TypingAt     int64    `dynamodbav:"typing_at,omitempty" json:"-"`
+	TTL          int64    `dynamodbav:"ttl" json:"ttl"`
+}
+
+func (connection Connection) GetKey() map[string]types.AttributeValue {
+	connectionId, err := attributevalue.Marshal(connection.ConnectionId)
+	if err != nil {
+		panic(err)
+	}
+
+	return map[string]types.AttributeValue{"connection_id": connectionId}
+}
+
+type ConnectionDatabase struct {
+	Client    *dynamodb.Client
+	TableName string
+}
+
+func (db ConnectionDatabase) CreateConnection(ctx context.Context, connection Connection) error {
+	item, err := attributevalue.MarshalMap(connection)
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = db.Client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(db.TableName),
+		Item:      item,
+	})
+
+	if err != nil {
+		log.Printf("Item could not be added, %v", err)
+	}
+	return err
+}
+
+func (db ConnectionDatabase) GetConnection(ctx context.Context, connectionId string) (Connection, error) {
+	connection := Connection{ConnectionId: connectionId}
+	response, err := db.Client.GetItem(ctx, &dynamodb.GetItemInput{
+		Key:       connection.GetKey(),
+		TableName: aws.String(db.TableName),
+	})
+	if err != nil {
+		log.Printf("Item could not be got, %v", err)
+	} else {
+		err = attributevalue.UnmarshalMap(response.Item, &connection)
+		if err != nil {
+			log.Printf("Failed to Unmarshal Item, %v", err)
+		}
+	}
+	return connection, err
+}
+
+// GetCodecs looks up the codec of every connection, connections that are
+// gone or never chose one get JSON.
+func (db ConnectionDatabase) GetCodecs(ctx context.Context, connectionIds []string) (map[string]Codec, error) {
+	codecs := map[string]Codec{}
+	for _, connectionId := range connectionIds {
+		codecs[connectionId] = JSONCodec
+	}
+
+	projection, err := expression.NewBuilder().WithProjection(expression.NamesList(expression.Name("connection_id"), expression.Name("codec"))).Build()
+	if err != nil {
+		log.Printf("Item could not build expression, %v", err)
+		return codecs, err
+	}
+
+	// DynamoDB limits a batch get to 100 keys
+	for start := 0; start < len(connectionIds); start += 100 {
+		keys := []map[string]types.AttributeValue{}
+		for _, connectionId := range connectionIds[start:min(len(connectionIds), start+100)] {
+			keys = append(keys, Connection{ConnectionId: connectionId}.GetKey())
+		}
+
+		for len(keys) > 0 {
+			var connections []Connection
+
+			response, err := db.Client.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+				RequestItems: map[string]types.KeysAndAttributes{db.TableName: {
+					Keys:                     keys,
+					ProjectionExpression:     projection.Projection(),
+					ExpressionAttributeNames: projection.Names(),
+				}},
+			})
+			if err != nil {
+				log.Printf("Items could not be got, %v", err)
+				return codecs, err
+			}
+
+			err = attributevalue.UnmarshalListOfMaps(response.Responses[db.TableName], &connections)
+			if err != nil {
+				log.Printf("Failed to Unmarshal Items, %v", err)
+				return codecs, err
+			}
+			for _, connection := range connections {
+				if connection.Codec != "" {
+					codecs[connection.ConnectionId] = connection.Codec
+				}
+			}
+
+			keys = response.UnprocessedKeys[db.TableName].Keys
+		}
+	}
+	return codecs, nil
+}
+
+func (db ConnectionDatabase) AddCall(ctx context.Context, connectionId string, callId string) error {
+	return db.updateCalls(ctx, connectionId, expression.Add(expression.Name("call_ids"), expression.Value(&types.AttributeValueMemberSS{Value: []string{callId}})))
+}
+
+func (db ConnectionDatabase) RemoveCall(ctx context.Context, connectionId string, callId string) error {
+	return db.updateCalls(ctx, connectionId, expression.Delete(expression.Name("call_ids"), expression.Value(&types.AttributeValueMemberSS{Value: []string{callId}})))
+}
+
+func (db ConnectionDatabase) updateCalls(ctx context.Context, connectionId string, update expression.UpdateBuilder) error {
+	// never recreate the record of a connection that is already gone
+	condition := expression.AttributeExists(expression.Name("connection_id"))
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		log.Printf("Item could not build expression, %v", err)
+		return err
+	}
+
+	_, err = db.Client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(db.TableName),
+		Key:                       Connection{ConnectionId: connectionId}.GetKey(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+	})
+	if err != nil {
+		log.Printf("Item could not be updated, %v", err)
+	}
+	return err
+}
+
+func (db ConnectionDatabase) DeleteConnection(ctx context.Context, connectionId string) error {
+	_, err := db.Client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(db.TableName),
+		Key:       Connection{ConnectionId: connectionId}.GetKey(),
+	})
+	if err != nil {
+		log.Printf("Item could not be deleted, %v", err)
+	}
+	return err
+}
+
+// Typing records that the connection is typing in a call. It reports false,
+// without an error, when the connection already did so within TypingWindow
+// and the event should be coalesced into that one.
+func (db ConnectionDatabase) Typing(ctx context.Context, connectionId string, callId string, now time.Time) (bool, error) {
+	update := expression.Set(expression.Name("typing_call_id"), expression.Value(callId)).
+		Set(expression.Name("typing_at"), expression.Value(now.UnixMilli()))
+	condition := expression.And(
+		expression.AttributeExists(expression.Name("connection_id")),
+		expression.Not(expression.And(
+			expression.Name("typing_call_id").Equal(expression.Value(callId)),
+			expression.Name("typing_at").GreaterThan(expression.Value(now.Add(-TypingWindow).UnixMilli())),
+		)),
+	)
+
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		log.Printf("Item could not build expression, %v", err)
+		return false, err
+	}
+
+	_, err = db.Client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(db.TableName),
+		Key:                       Connection{ConnectionId: connectionId}.GetKey(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+	})
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return false, nil
+	}
+	if err != nil {
+		log.Printf("Item could not be updated, %v", err)
+		return false, err
+	}
+	return true, nil
+}
+
+// GetUserConnections returns every open connection of a user.
+func (db ConnectionDatabase) GetUserConnections(ctx context.Context, userId string) ([]Connection, error) {
+	connections := []Connection{}
+
+	keyCondition := expression.Key("user_id").Equal(expression.Value(userId))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCondition).Build()
+	if err != nil {
+		log.Printf("Item could not build expression, %v", err)
+		return connections, err
+	}
+
+	paginator := dynamodb.NewQueryPaginator(db.Client, &dynamodb.QueryInput{
+		TableName:                 aws.String(db.TableName),
+		IndexName:                 aws.String(dyscordconfig.USER_INDEXNAME),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+	for paginator.HasMorePages() {
+		var page []Connection
+
+		response, err := paginator.NextPage(ctx)
+		if err != nil {
+			log.Printf("Items could not be queried, %v", err)
+			return connections, err
+		}
+		err = attributevalue.UnmarshalListOfMaps(response.Items, &page)
+		if err != nil {
+			log.Printf("Failed to Unmarshal Items, %v", err)
+			return connections, err
+		}
+		connections = append(connections, page...)
+	}
+	return connections, nil
+}
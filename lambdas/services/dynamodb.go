@@ -2,8 +2,10 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"slices"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
@@ -12,16 +14,30 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
+// MaxParticipants caps the size of a call, every participant holds a peer
+// connection to each of the others.
+const MaxParticipants = 16
+
+// leaveAttempts is how often LeaveCall reads the call again after losing a
+// race for the index of a description.
+const leaveAttempts = 3
+
 type Call struct {
-	CallId         string `dynamodbav:"call_id" json:"call_id"`
-	ConnectionSdps []SDP  `dynamodbav:"connection_sdps" json:"connection_sdps"`
-	TTL            int64  `dynamodbav:"ttl" json:"ttl"`
+	CallId         string   `dynamodbav:"call_id" json:"call_id"`
+	ConnectionSdps []SDP    `dynamodbav:"connection_sdps" json:"connection_sdps"`
+	Moderators     []string `dynamodbav:"moderators,omitempty" json:"moderators"`
+	CreatedBy      string   `dynamodbav:"created_by,omitempty" json:"-"`
+	EndedBy        string   `dynamodbav:"ended_by,omitempty" json:"-"`
+	TTL            int64    `dynamodbav:"ttl" json:"ttl"`
 }
 
+// SDP is a participant's entry in the call. Session descriptions themselves
+// are not stored: they are relayed pair by pair through signal.
 type SDP struct {
-	ConnectionId               string `dynamodbav:"connection_id" json:"connection_id"`
-	Type                       string `dynamodbav:"type" json:"type"`
-	SessionDescriptionProtocol string `dynamodbav:"sdp" json:"sdp"`
+	ConnectionId  string `dynamodbav:"connection_id" json:"connection_id"`
+	NegotiationId int64  `dynamodbav:"negotiation_id" json:"negotiation_id"`
+	UserId        string `dynamodbav:"user_id" json:"user_id"`
+	DisplayName   string `dynamodbav:"display_name" json:"display_name"`
 }
 
 func (call Call) GetKey() map[string]types.AttributeValue {
@@ -33,6 +49,46 @@ func (call Call) GetKey() map[string]types.AttributeValue {
 	return map[string]types.AttributeValue{"call_id": callId}
 }
 
+func (call Call) GetSDP(connectionId string) (SDP, int, bool) {
+	for index, sdp := range call.ConnectionSdps {
+		if sdp.ConnectionId == connectionId {
+			return sdp, index, true
+		}
+	}
+	return SDP{}, -1, false
+}
+
+func (call Call) IsModerator(principal string) bool {
+	return principal != "" && slices.Contains(call.Moderators, principal)
+}
+
+// Exists reports whether the call was found, calls are always stored with a
+// list of connections even when it is empty.
+func (call Call) Exists() bool {
+	return call.ConnectionSdps != nil
+}
+
+func (call Call) HasConnection(connectionId string) bool {
+	for _, sdp := range call.ConnectionSdps {
+		if sdp.ConnectionId == connectionId {
+			return true
+		}
+	}
+	return false
+}
+
+// ConnectionIds returns the connections of every participant of the call
+// except the ones given.
+func (call Call) ConnectionIds(except ...string) []string {
+	connectionIds := []string{}
+	for _, sdp := range call.ConnectionSdps {
+		if !slices.Contains(except, sdp.ConnectionId) {
+			connectionIds = append(connectionIds, sdp.ConnectionId)
+		}
+	}
+	return connectionIds
+}
+
 type CallDatabase struct {
 	Client    *dynamodb.Client
 	TableName string
@@ -96,18 +152,32 @@ func (db CallDatabase) JoinCall(ctx context.Context, call Call, connectionId str
 			expression.Value(&types.AttributeValueMemberL{Value: []types.AttributeValue{&types.AttributeValueMemberM{Value: marshalledSdp}}}),
 		),
 	)
-	expr, err := expression.NewBuilder().WithUpdate(update).Build()
+	// never recreate a call that has ended
+	condition := expression.And(
+		expression.AttributeExists(expression.Name("call_id")),
+		expression.Name("connection_sdps").Size().LessThan(expression.Value(MaxParticipants)),
+	)
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
 	if err != nil {
 		log.Printf("Item could not build expression, %v", err)
 	} else {
 		response, err = db.Client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
-			TableName:                 aws.String(db.TableName),
-			Key:                       call.GetKey(),
-			ExpressionAttributeNames:  expr.Names(),
-			ExpressionAttributeValues: expr.Values(),
-			UpdateExpression:          expr.Update(),
-			ReturnValues:              types.ReturnValueUpdatedNew,
+			TableName:                           aws.String(db.TableName),
+			Key:                                 call.GetKey(),
+			ExpressionAttributeNames:            expr.Names(),
+			ExpressionAttributeValues:           expr.Values(),
+			UpdateExpression:                    expr.Update(),
+			ConditionExpression:                 expr.Condition(),
+			ReturnValues:                        types.ReturnValueUpdatedNew,
+			ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
 		})
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			if conditionFailed.Item == nil {
+				return responseValues, Errorf(CallNotFound, "Call %v does not exist", call.CallId)
+			}
+			return responseValues, Errorf(CallFull, "Call %v already has %v participants", call.CallId, MaxParticipants)
+		}
 		if err != nil {
 			log.Printf("Item could not be updated, %v", err)
 		} else {
@@ -121,71 +191,190 @@ func (db CallDatabase) JoinCall(ctx context.Context, call Call, connectionId str
 	return responseValues, err
 }
 
+// LeaveCall removes a connection from a call, deleting the call once it is
+// empty. The description is removed by its index on the condition it still
+// belongs to the connection, so two removals racing each other never take out
+// another participant; the loser reads the call again and finds the
+// connection gone.
 func (db CallDatabase) LeaveCall(ctx context.Context, call Call, connectionId string) (map[string]any, error) {
 	var responseValues map[string]any
 
-	originalCall, err := db.GetCall(ctx, call.CallId)
+	for attempt := 0; attempt < leaveAttempts; attempt++ {
+		originalCall, err := db.GetCall(ctx, call.CallId)
 
-	if err != nil {
-		log.Println(err.Error())
-	}
+		if err != nil {
+			return responseValues, err
+		}
 
-	found := false
-	connectionIndex := -1
-	for index, value := range originalCall.ConnectionSdps {
-		if connectionId == value.ConnectionId {
-			found = true
-			connectionIndex = index
-			break
+		_, connectionIndex, found := originalCall.GetSDP(connectionId)
+
+		if !found && attempt > 0 && originalCall.Exists() {
+			// removed by whoever won the race
+			return responseValues, nil
+		}
+		if !found {
+			return responseValues, NotInCall(originalCall, connectionId)
 		}
-	}
 
-	if !found {
-		log.Println("Could not find any sdp that matches")
-	}
+		path := fmt.Sprintf("connection_sdps[%v]", connectionIndex)
+		update := expression.Remove(expression.Name(path))
+		condition := expression.Name(path + ".connection_id").Equal(expression.Value(connectionId))
 
-	update := expression.Remove(
-		expression.Name(fmt.Sprintf("connection_sdps[%v]", connectionIndex)),
-	)
+		expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+		if err != nil {
+			log.Printf("Item could not build expression, %v", err)
+			return responseValues, err
+		}
 
-	expr, err := expression.NewBuilder().WithUpdate(update).Build()
-	if err != nil {
-		log.Printf("Item could not build expression, %v", err)
-	} else {
 		_, err = db.Client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
-			TableName:                 aws.String(db.TableName),
-			Key:                       call.GetKey(),
-			ExpressionAttributeNames:  expr.Names(),
-			ExpressionAttributeValues: expr.Values(),
-			UpdateExpression:          expr.Update(),
-			ReturnValues:              types.ReturnValueUpdatedNew,
+			TableName:                           aws.String(db.TableName),
+			Key:                                 call.GetKey(),
+			ExpressionAttributeNames:            expr.Names(),
+			ExpressionAttributeValues:           expr.Values(),
+			UpdateExpression:                    expr.Update(),
+			ConditionExpression:                 expr.Condition(),
+			ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
 		})
+
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) && conditionFailed.Item == nil {
+			return responseValues, Errorf(CallNotFound, "Call %v does not exist", call.CallId)
+		}
+		if errors.As(err, &conditionFailed) {
+			continue
+		}
 		if err != nil {
 			log.Printf("Item could not be updated, %v", err)
+			return responseValues, err
 		}
+
+		return db.deleteIfEmpty(ctx, call)
 	}
+
+	return responseValues, Errorf(Conflict, "The call %v kept changing while connection %v left it", call.CallId, connectionId)
+}
+
+// deleteIfEmpty deletes a call nobody is in anymore.
+func (db CallDatabase) deleteIfEmpty(ctx context.Context, call Call) (map[string]any, error) {
+	var responseValues map[string]any
+
 	condition := expression.Name("connection_sdps").Size().Equal(expression.Value(0))
-	expr, err = expression.NewBuilder().WithCondition(condition).Build()
+	expr, err := expression.NewBuilder().WithCondition(condition).Build()
 	if err != nil {
 		log.Printf("Item could not build expression, %v", err)
-	} else {
-		response, err := db.Client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
-			TableName:                 aws.String(db.TableName),
-			Key:                       call.GetKey(),
-			ExpressionAttributeNames:  expr.Names(),
-			ExpressionAttributeValues: expr.Values(),
-			ConditionExpression:       expr.Condition(),
-			ReturnValues:              types.ReturnValueNone,
-		})
-		if err != nil {
-			log.Printf("Item could not be updated, %v", err)
-		} else {
-			err = attributevalue.UnmarshalMap(response.Attributes, &responseValues)
-			if err != nil {
-				log.Printf("Unable to unmarshal map, %v", err)
-			}
-		}
+		return responseValues, err
 	}
 
+	response, err := db.Client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:                 aws.String(db.TableName),
+		Key:                       call.GetKey(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ConditionExpression:       expr.Condition(),
+		ReturnValues:              types.ReturnValueNone,
+	})
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		// others are still in the call
+		return responseValues, nil
+	}
+	if err != nil {
+		log.Printf("Item could not be deleted, %v", err)
+		return responseValues, err
+	}
+
+	err = attributevalue.UnmarshalMap(response.Attributes, &responseValues)
+	if err != nil {
+		log.Printf("Unable to unmarshal map, %v", err)
+	}
 	return responseValues, err
 }
+
+// EndCall deletes a call for everyone in it. Who ended it is recorded on the
+// call first, so the REMOVE record of the stream can tell.
+func (db CallDatabase) EndCall(ctx context.Context, call Call, principal string) error {
+	update := expression.Set(expression.Name("ended_by"), expression.Value(principal))
+	condition := expression.AttributeExists(expression.Name("call_id"))
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		log.Printf("Item could not build expression, %v", err)
+		return err
+	}
+
+	_, err = db.Client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(db.TableName),
+		Key:                       call.GetKey(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+	})
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return Errorf(CallNotFound, "Call %v does not exist", call.CallId)
+	}
+	if err != nil {
+		log.Printf("Item could not be updated, %v", err)
+		return err
+	}
+
+	_, err = db.Client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(db.TableName),
+		Key:       call.GetKey(),
+	})
+	if err != nil {
+		log.Printf("Item could not be deleted, %v", err)
+	}
+	return err
+}
+
+// Renegotiate bumps the negotiation id of a connection, so answers to its
+// older offers can be told apart. The update is conditional on the connection
+// not having moved or renegotiated since the call was read.
+func (db CallDatabase) Renegotiate(ctx context.Context, call Call, connectionId string) (SDP, error) {
+	sdp, index, found := call.GetSDP(connectionId)
+	if !found {
+		return sdp, NotInCall(call, connectionId)
+	}
+
+	path := fmt.Sprintf("connection_sdps[%v]", index)
+	negotiation := expression.Name(path + ".negotiation_id")
+	update := expression.Set(negotiation, expression.Value(sdp.NegotiationId+1))
+	unchanged := negotiation.Equal(expression.Value(sdp.NegotiationId))
+	if sdp.NegotiationId == 0 {
+		unchanged = expression.Or(expression.AttributeNotExists(negotiation), unchanged)
+	}
+	condition := expression.And(
+		expression.Name(path+".connection_id").Equal(expression.Value(connectionId)),
+		unchanged,
+	)
+
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		log.Printf("Item could not build expression, %v", err)
+		return sdp, err
+	}
+
+	_, err = db.Client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(db.TableName),
+		Key:                       call.GetKey(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+	})
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return sdp, Errorf(Conflict, "The negotiation of connection %v changed, try again", connectionId)
+	}
+	if err != nil {
+		log.Printf("Item could not be updated, %v", err)
+		return sdp, err
+	}
+
+	sdp.NegotiationId++
+	return sdp, nil
+}
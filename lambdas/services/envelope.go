@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewaymanagementapi"
+)
+
+// EnvelopeVersion is bumped whenever the envelope changes in a way older
+// clients cannot read.
+const EnvelopeVersion = 1
+
+// Envelope wraps everything sent to a client, both responses and pushes.
+// RequestId echoes the request_id a client sent alongside the action so it
+// can match responses to its requests; pushes have none. Exactly one of Data
+// and Error is set.
+type Envelope struct {
+	V         int          `json:"v"`
+	Action    string       `json:"action"`
+	RequestId string       `json:"request_id,omitempty"`
+	Data      any          `json:"data,omitempty"`
+	Error     *ActionError `json:"error,omitempty"`
+}
+
+func NewEnvelope(action string, data any) Envelope {
+	return Envelope{V: EnvelopeVersion, Action: action, Data: data}
+}
+
+// RequestId returns the request_id the client sent in the body, if any.
+func RequestId(request events.APIGatewayWebsocketProxyRequest) string {
+	var body struct {
+		RequestId string `json:"request_id"`
+	}
+	json.Unmarshal([]byte(request.Body), &body)
+	return body.RequestId
+}
+
+// Respond answers a request with data in an envelope.
+func Respond(ctx context.Context, request events.APIGatewayWebsocketProxyRequest, action string, data any) (events.APIGatewayProxyResponse, error) {
+	envelope := NewEnvelope(action, data)
+	envelope.RequestId = RequestId(request)
+	return envelopeResponse(ctx, request, 200, envelope)
+}
+
+func respondActionError(ctx context.Context, request events.APIGatewayWebsocketProxyRequest, action string, actionError ActionError) (events.APIGatewayProxyResponse, error) {
+	envelope := Envelope{V: EnvelopeVersion, Action: action, RequestId: RequestId(request), Error: &actionError}
+	return envelopeResponse(ctx, request, actionError.Code.StatusCode(), envelope)
+}
+
+// envelopeResponse encodes an envelope in the codec of the caller's
+// connection. API Gateway sends route responses as text frames, so
+// MessagePack responses are posted to the connection as binary instead and
+// the route response is left empty.
+func envelopeResponse(ctx context.Context, request events.APIGatewayWebsocketProxyRequest, statusCode int, envelope Envelope) (events.APIGatewayProxyResponse, error) {
+	codec := CallerCodec(request)
+	responseBody, err := codec.Marshal(envelope)
+
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Sever Error"}, nil
+	}
+
+	// nothing can be sent to a connection that is not open (anymore)
+	if codec == MessagePackCodec && request.RequestContext.EventType == "MESSAGE" {
+		if err = postResponse(ctx, request, responseBody); err != nil {
+			log.Printf("Could not post response to %v, %v", request.RequestContext.ConnectionID, err)
+			return events.APIGatewayProxyResponse{StatusCode: 500}, nil
+		}
+		return events.APIGatewayProxyResponse{StatusCode: statusCode}, nil
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			"Content-Type": codec.ContentType(),
+		},
+		Body: string(responseBody),
+	}, nil
+}
+
+var (
+	responseClientsMutex sync.Mutex
+	responseClients      = map[string]*apigatewaymanagementapi.Client{}
+)
+
+// postResponse posts a response to the caller through the management API of
+// the stage the request came in on, unless AWS_ENDPOINT points elsewhere.
+func postResponse(ctx context.Context, request events.APIGatewayWebsocketProxyRequest, data []byte) error {
+	endpoint := os.Getenv("AWS_ENDPOINT")
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%v/%v", request.RequestContext.DomainName, request.RequestContext.Stage)
+	}
+
+	responseClientsMutex.Lock()
+	client, ok := responseClients[endpoint]
+	if !ok {
+		cfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			responseClientsMutex.Unlock()
+			return err
+		}
+		client = apigatewaymanagementapi.NewFromConfig(cfg, func(o *apigatewaymanagementapi.Options) {
+			o.BaseEndpoint = aws.String(endpoint)
+		})
+		responseClients[endpoint] = client
+	}
+	responseClientsMutex.Unlock()
+
+	_, err := client.PostToConnection(ctx, &apigatewaymanagementapi.PostToConnectionInput{
+		ConnectionId: aws.String(request.RequestContext.ConnectionID),
+		Data:         data,
+	})
+	return err
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// ErrorCode tells clients what went wrong with a request. Clients switch on
+// the code, the message of an error is only meant for people.
+type ErrorCode string
+
+const (
+	InvalidRequest  ErrorCode = "invalid_request"
+	UnknownAction   ErrorCode = "unknown_action"
+	Forbidden       ErrorCode = "forbidden"
+	NotParticipant  ErrorCode = "not_participant"
+	CallNotFound    ErrorCode = "call_not_found"
+	MessageNotFound ErrorCode = "message_not_found"
+	AlreadyJoined   ErrorCode = "already_joined"
+	CallFull        ErrorCode = "call_full"
+	Conflict        ErrorCode = "conflict"
+	Internal        ErrorCode = "internal"
+)
+
+var statusCodes = map[ErrorCode]int{
+	InvalidRequest:  400,
+	UnknownAction:   400,
+	Forbidden:       403,
+	NotParticipant:  403,
+	CallNotFound:    404,
+	MessageNotFound: 404,
+	AlreadyJoined:   409,
+	CallFull:        409,
+	Conflict:        409,
+	Internal:        500,
+}
+
+func (code ErrorCode) StatusCode() int {
+	if statusCode, ok := statusCodes[code]; ok {
+		return statusCode
+	}
+	return 500
+}
+
+// Error is an error that is safe to send to clients. Any other error is
+// logged and reported to the client as internal, so nothing the AWS SDK says
+// ever reaches them.
+type Error struct {
+	Code    ErrorCode
+	Message string
+	Fields  []FieldError
+}
+
+func (err *Error) Error() string {
+	return err.Message
+}
+
+func Errorf(code ErrorCode, format string, args ...any) error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+var ErrInvalidBody = Errorf(InvalidRequest, "Could not parse body")
+
+// NotInCall is the error for a connection acting on a call it is not in,
+// telling apart calls that do not exist (anymore).
+func NotInCall(call Call, connectionId string) error {
+	if !call.Exists() {
+		return Errorf(CallNotFound, "Call %v does not exist", call.CallId)
+	}
+	return Errorf(NotParticipant, "Connection %v is not in the call %v", connectionId, call.CallId)
+}
+
+// RespondError answers a request with an error in an envelope.
+func RespondError(ctx context.Context, request events.APIGatewayWebsocketProxyRequest, action string, err error) (events.APIGatewayProxyResponse, error) {
+	var clientError *Error
+	if !errors.As(err, &clientError) {
+		log.Printf("%v failed, %v", action, err)
+		clientError = &Error{Code: Internal, Message: "Internal server error"}
+	}
+	return respondActionError(ctx, request, action, ActionError{Code: clientError.Code, Message: clientError.Message, Fields: clientError.Fields})
+}
@@ -2,26 +2,261 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/apigatewaymanagementapi"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewaymanagementapi/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/smithy-go"
+
+	dyscordconfig "dyscord-backend/config"
+)
+
+const (
+	// MaxConcurrentPosts bounds how many posts of one fan-out are in flight
+	MaxConcurrentPosts = 16
+	// MaxPostAttempts is how often a throttled post is tried before giving up
+	MaxPostAttempts = 4
+	postBackoff     = 50 * time.Millisecond
+	maxPostBackoff  = time.Second
 )
 
+// DeliveryStatus is what became of a push to one connection.
+type DeliveryStatus string
+
+const (
+	Delivered DeliveryStatus = "delivered"
+	// Gone means the connection is closed and will never receive anything
+	Gone DeliveryStatus = "gone"
+	// Throttled means API Gateway kept throttling the post through every retry
+	Throttled DeliveryStatus = "throttled"
+	Failed    DeliveryStatus = "failed"
+)
+
+type DeliveryResult struct {
+	ConnectionId string
+	Status       DeliveryStatus
+	Err          error
+}
+
+// DeliveryReport has a result for every connection of a fan-out, in the
+// order they were given.
+type DeliveryReport []DeliveryResult
+
+// ConnectionIds returns the connections whose push ended with the status.
+func (report DeliveryReport) ConnectionIds(status DeliveryStatus) []string {
+	connectionIds := []string{}
+	for _, result := range report {
+		if result.Status == status {
+			connectionIds = append(connectionIds, result.ConnectionId)
+		}
+	}
+	return connectionIds
+}
+
+// Err reports the pushes that could not be delivered. Connections that are
+// gone are not an error, there is nobody left to deliver to.
+func (report DeliveryReport) Err() error {
+	undelivered := len(report.ConnectionIds(Throttled)) + len(report.ConnectionIds(Failed))
+	if undelivered == 0 {
+		return nil
+	}
+	return fmt.Errorf("%v of %v pushes were not delivered", undelivered, len(report))
+}
+
+// ConnectionPoster posts data to a single connection, as the API Gateway
+// management API does.
+type ConnectionPoster interface {
+	PostToConnection(ctx context.Context, params *apigatewaymanagementapi.PostToConnectionInput, optFns ...func(*apigatewaymanagementapi.Options)) (*apigatewaymanagementapi.PostToConnectionOutput, error)
+}
+
+// APIGatewayManagementClient pushes messages to connections, each in the
+// codec its connection chose. Without Connections to look the codecs up in,
+// every push is JSON. With Calls as well, connections found gone are evicted
+// from their calls.
 type APIGatewayManagementClient struct {
-	Client *apigatewaymanagementapi.Client
+	Client      ConnectionPoster
+	Connections ConnectionDatabase
+	Calls       CallDatabase
 }
 
-func (c *APIGatewayManagementClient) PostToConnections(ctx context.Context, connectionIds []string, data []byte) {
+// NewAPIGatewayManagementClient builds a client that posts through the
+// endpoint in AWS_ENDPOINT and keeps the connections and calls tables with
+// the given DynamoDB client.
+func NewAPIGatewayManagementClient(cfg aws.Config, client *dynamodb.Client) APIGatewayManagementClient {
+	return APIGatewayManagementClient{
+		Client: apigatewaymanagementapi.NewFromConfig(cfg, func(o *apigatewaymanagementapi.Options) {
+			o.BaseEndpoint = aws.String(os.Getenv("AWS_ENDPOINT"))
+		}),
+		Connections: ConnectionDatabase{
+			Client:    client,
+			TableName: dyscordconfig.CONNECTIONS_TABLENAME,
+		},
+		Calls: CallDatabase{
+			Client:    client,
+			TableName: dyscordconfig.TABLENAME,
+		},
+	}
+}
+
+// PostToConnections pushes a message to every connection concurrently. A
+// failed post never stops the others, what became of each is in the report.
+func (c *APIGatewayManagementClient) PostToConnections(ctx context.Context, connectionIds []string, message any) DeliveryReport {
+	report := make(DeliveryReport, len(connectionIds))
+	if len(connectionIds) == 0 {
+		return report
+	}
+
+	codecs := map[string]Codec{}
+	if c.Connections.Client != nil {
+		var err error
+		if codecs, err = c.Connections.GetCodecs(ctx, connectionIds); err != nil {
+			log.Printf("Could not look up codecs, %v", err)
+		}
+	}
+
+	// every codec only encodes the message once
+	encoded := map[Codec][]byte{}
+	encodeErrors := map[Codec]error{}
 	for _, connectionId := range connectionIds {
-		output, err := c.Client.PostToConnection(ctx, &apigatewaymanagementapi.PostToConnectionInput{
+		codec, ok := codecs[connectionId]
+		if !ok {
+			codec = JSONCodec
+		}
+		if _, ok := encoded[codec]; ok {
+			continue
+		}
+		if _, ok := encodeErrors[codec]; ok {
+			continue
+		}
+		if data, err := codec.Marshal(message); err != nil {
+			encodeErrors[codec] = err
+		} else {
+			encoded[codec] = data
+		}
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, MaxConcurrentPosts)
+	for index, connectionId := range connectionIds {
+		codec, ok := codecs[connectionId]
+		if !ok {
+			codec = JSONCodec
+		}
+		if err, ok := encodeErrors[codec]; ok {
+			report[index] = DeliveryResult{ConnectionId: connectionId, Status: Failed, Err: err}
+			continue
+		}
+
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(index int, connectionId string, data []byte) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			report[index] = c.post(ctx, connectionId, data)
+		}(index, connectionId, encoded[codec])
+	}
+	wg.Wait()
+
+	for _, result := range report {
+		if result.Status != Delivered && result.Status != Gone {
+			log.Printf("Could not post to %v (%v), %v", result.ConnectionId, result.Status, result.Err)
+		}
+	}
+
+	if c.Connections.Client != nil && c.Calls.Client != nil {
+		for _, connectionId := range report.ConnectionIds(Gone) {
+			if err := c.Evict(ctx, connectionId); err != nil {
+				log.Printf("Could not evict %v, %v", connectionId, err)
+			}
+		}
+	}
+	return report
+}
+
+func (c *APIGatewayManagementClient) PostToConnection(ctx context.Context, connectionId string, message any) DeliveryResult {
+	return c.PostToConnections(ctx, []string{connectionId}, message)[0]
+}
+
+// Evict removes a connection from every call it joined and forgets the
+// connection. The remaining participants hear it left from the stream of the
+// calls table.
+func (c *APIGatewayManagementClient) Evict(ctx context.Context, connectionId string) error {
+	connection, err := c.Connections.GetConnection(ctx, connectionId)
+
+	if err != nil {
+		return err
+	}
+
+	for _, callId := range connection.CallIds {
+		call, err := c.Calls.GetCall(ctx, callId)
+		if err != nil || !call.HasConnection(connectionId) {
+			continue
+		}
+
+		if _, err = c.Calls.LeaveCall(ctx, call, connectionId); err != nil {
+			log.Printf("Could not remove %v from call %v, %v", connectionId, callId, err)
+		}
+	}
+
+	return c.Connections.DeleteConnection(ctx, connectionId)
+}
+
+// post sends data to one connection, retrying throttled posts with full
+// jitter backoff.
+func (c *APIGatewayManagementClient) post(ctx context.Context, connectionId string, data []byte) DeliveryResult {
+	result := DeliveryResult{ConnectionId: connectionId}
+	backoff := postBackoff
+
+	for attempt := 1; ; attempt++ {
+		_, err := c.Client.PostToConnection(ctx, &apigatewaymanagementapi.PostToConnectionInput{
 			ConnectionId: aws.String(connectionId),
 			Data:         data,
 		})
 
-		log.Println(output)
-		if err != nil {
-			log.Fatal(err.Error())
+		result.Status, result.Err = deliveryStatus(err), err
+		if result.Status != Throttled || attempt == MaxPostAttempts {
+			return result
+		}
+
+		select {
+		case <-ctx.Done():
+			result.Err = ctx.Err()
+			return result
+		case <-time.After(time.Duration(rand.Int63n(int64(backoff)))):
+		}
+		backoff = min(2*backoff, maxPostBackoff)
+	}
+}
+
+func deliveryStatus(err error) DeliveryStatus {
+	if err == nil {
+		return Delivered
+	}
+
+	var gone *types.GoneException
+	if errors.As(err, &gone) {
+		return Gone
+	}
+
+	var limitExceeded *types.LimitExceededException
+	if errors.As(err, &limitExceeded) {
+		return Throttled
+	}
+
+	var apiError smithy.APIError
+	if errors.As(err, &apiError) {
+		switch apiError.ErrorCode() {
+		case "ThrottlingException", "TooManyRequestsException":
+			return Throttled
 		}
 	}
+	return Failed
 }
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewaymanagementapi"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewaymanagementapi/types"
+	"github.com/aws/smithy-go"
+)
+
+var (
+	errGone      = &types.GoneException{}
+	errThrottled = &types.LimitExceededException{}
+	errForbidden = &smithy.GenericAPIError{Code: "ForbiddenException"}
+)
+
+// fakePoster answers the posts to every connection with its errors in turn,
+// then with success, and records what it was given.
+type fakePoster struct {
+	mutex    sync.Mutex
+	errors   map[string][]error
+	attempts map[string]int
+	data     map[string][]byte
+}
+
+func newFakePoster(errors map[string][]error) *fakePoster {
+	return &fakePoster{errors: errors, attempts: map[string]int{}, data: map[string][]byte{}}
+}
+
+func (poster *fakePoster) PostToConnection(ctx context.Context, params *apigatewaymanagementapi.PostToConnectionInput, optFns ...func(*apigatewaymanagementapi.Options)) (*apigatewaymanagementapi.PostToConnectionOutput, error) {
+	poster.mutex.Lock()
+	defer poster.mutex.Unlock()
+
+	connectionId := aws.ToString(params.ConnectionId)
+	attempt := poster.attempts[connectionId]
+	poster.attempts[connectionId]++
+	poster.data[connectionId] = params.Data
+
+	if errs := poster.errors[connectionId]; attempt < len(errs) && errs[attempt] != nil {
+		return nil, errs[attempt]
+	}
+	return &apigatewaymanagementapi.PostToConnectionOutput{}, nil
+}
+
+func repeat(err error, times int) []error {
+	errs := []error{}
+	for range times {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+func TestDeliveryStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status DeliveryStatus
+	}{
+		{"delivered", nil, Delivered},
+		{"gone", errGone, Gone},
+		{"wrapped gone", fmt.Errorf("operation error, %w", errGone), Gone},
+		{"limit exceeded", errThrottled, Throttled},
+		{"throttling", &smithy.GenericAPIError{Code: "ThrottlingException"}, Throttled},
+		{"too many requests", &smithy.GenericAPIError{Code: "TooManyRequestsException"}, Throttled},
+		{"other api error", errForbidden, Failed},
+		{"other error", errors.New("connection reset"), Failed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if status := deliveryStatus(test.err); status != test.status {
+				t.Errorf("deliveryStatus(%v) = %v, expected %v", test.err, status, test.status)
+			}
+		})
+	}
+}
+
+func TestPostToConnections(t *testing.T) {
+	poster := newFakePoster(map[string][]error{
+		"flaky":     repeat(errThrottled, MaxPostAttempts-1),
+		"throttled": repeat(errThrottled, MaxPostAttempts+1),
+		"gone":      {errGone},
+		"forbidden": {errForbidden},
+	})
+	api := APIGatewayManagementClient{Client: poster}
+
+	connectionIds := []string{"ok", "flaky", "throttled", "gone", "forbidden"}
+	report := api.PostToConnections(context.Background(), connectionIds, NewEnvelope("typing", nil))
+
+	tests := []struct {
+		connectionId string
+		status       DeliveryStatus
+		attempts     int
+	}{
+		{"ok", Delivered, 1},
+		{"flaky", Delivered, MaxPostAttempts},
+		{"throttled", Throttled, MaxPostAttempts},
+		{"gone", Gone, 1},
+		{"forbidden", Failed, 1},
+	}
+
+	for index, test := range tests {
+		result := report[index]
+		if result.ConnectionId != test.connectionId || result.Status != test.status {
+			t.Errorf("result %v is %v %v, expected %v %v", index, result.ConnectionId, result.Status, test.connectionId, test.status)
+		}
+		if attempts := poster.attempts[test.connectionId]; attempts != test.attempts {
+			t.Errorf("posted to %v %v times, expected %v", test.connectionId, attempts, test.attempts)
+		}
+	}
+
+	if ids := report.ConnectionIds(Delivered); !slices.Equal(ids, []string{"ok", "flaky"}) {
+		t.Errorf("delivered to %q", ids)
+	}
+
+	var envelope Envelope
+	if err := json.Unmarshal(poster.data["ok"], &envelope); err != nil || envelope.Action != "typing" {
+		t.Errorf("expected a JSON envelope without codecs to look up, got %q", poster.data["ok"])
+	}
+}
+
+func TestPostToNoConnections(t *testing.T) {
+	poster := newFakePoster(nil)
+	api := APIGatewayManagementClient{Client: poster}
+
+	if report := api.PostToConnections(context.Background(), []string{}, NewEnvelope("typing", nil)); len(report) != 0 {
+		t.Fatalf("expected an empty report, got %v", report)
+	}
+	if len(poster.attempts) != 0 {
+		t.Fatalf("expected no posts, got %v", poster.attempts)
+	}
+}
+
+func TestPostToConnectionStopsRetryingWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	poster := newFakePoster(map[string][]error{"throttled": repeat(errThrottled, MaxPostAttempts)})
+	api := APIGatewayManagementClient{Client: poster}
+
+	result := api.PostToConnection(ctx, "throttled", NewEnvelope("typing", nil))
+
+	if result.Status != Throttled || !errors.Is(result.Err, context.Canceled) {
+		t.Fatalf("expected a throttled post given up on cancellation, got %+v", result)
+	}
+	if attempts := poster.attempts["throttled"]; attempts != 1 {
+		t.Fatalf("expected no retry after cancellation, got %v attempts", attempts)
+	}
+}
+
+func TestPostToConnectionsFailsOnUnencodableMessages(t *testing.T) {
+	poster := newFakePoster(nil)
+	api := APIGatewayManagementClient{Client: poster}
+
+	result := api.PostToConnection(context.Background(), "ok", map[string]any{"channel": make(chan int)})
+
+	if result.Status != Failed || result.Err == nil {
+		t.Fatalf("expected the post to fail, got %+v", result)
+	}
+	if len(poster.attempts) != 0 {
+		t.Fatalf("expected nothing to be posted, got %v", poster.attempts)
+	}
+}
+
+func TestDeliveryReportErr(t *testing.T) {
+	tests := []struct {
+		name   string
+		report DeliveryReport
+		err    string
+	}{
+		{"empty", DeliveryReport{}, ""},
+		{"delivered", DeliveryReport{{Status: Delivered}, {Status: Delivered}}, ""},
+		{"gone is not an error", DeliveryReport{{Status: Delivered}, {Status: Gone}}, ""},
+		{"throttled", DeliveryReport{{Status: Delivered}, {Status: Throttled}}, "1 of 2 pushes were not delivered"},
+		{"throttled and failed", DeliveryReport{{Status: Throttled}, {Status: Gone}, {Status: Failed}, {Status: Delivered}}, "2 of 4 pushes were not delivered"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.report.Err()
+			if test.err == "" && err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if test.err != "" && (err == nil || err.Error() != test.err) {
+				t.Fatalf("expected %q, got %v", test.err, err)
+			}
+		})
+	}
+}
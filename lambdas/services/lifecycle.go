@@ -0,0 +1,40 @@
+package services
+
+import "github.com/aws/aws-lambda-go/events"
+
+const (
+	CallCreated = "callCreated"
+	CallEnded   = "callEnded"
+)
+
+// CallEndReason tells clients why a call is gone.
+type CallEndReason string
+
+const (
+	// LastParticipantLeft is a call deleted by LeaveCall once it was empty
+	LastParticipantLeft CallEndReason = "last_participant_left"
+	// Expired is a call deleted by DynamoDB when its TTL passed
+	Expired      CallEndReason = "expired"
+	EndedByHost  CallEndReason = "ended_by_host"
+	ttlPrincipal               = "dynamodb.amazonaws.com"
+)
+
+// CallEvent tells clients a call was created or ended.
+type CallEvent struct {
+	CallId    string        `json:"call_id"`
+	ExpiresAt int64         `json:"expires_at,omitempty"`
+	Reason    CallEndReason `json:"reason,omitempty"`
+	EndedBy   string        `json:"ended_by,omitempty"`
+}
+
+// EndReason works out why the call of a REMOVE stream record was deleted.
+// Deletions by TTL are the only ones made by the DynamoDB service itself.
+func EndReason(record events.DynamoDBEventRecord, call Call) CallEndReason {
+	if identity := record.UserIdentity; identity != nil && identity.Type == "Service" && identity.PrincipalID == ttlPrincipal {
+		return Expired
+	}
+	if call.EndedBy != "" {
+		return EndedByHost
+	}
+	return LastParticipantLeft
+}
@@ -0,0 +1,413 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	dyscordconfig "dyscord-backend/config"
+)
+
+const (
+	MaxMessageLength   = 4000
+	DefaultMessagePage = 50
+	MaxMessagePage     = 100
+)
+
+// Message is a chat message sent by a participant of a call.
+type Message struct {
+	CallId       string       `dynamodbav:"call_id" json:"call_id"`
+	MessageId    string       `dynamodbav:"message_id" json:"message_id"`
+	ClientMsgId  string       `dynamodbav:"client_msg_id" json:"client_msg_id"`
+	ConnectionId string       `dynamodbav:"connection_id" json:"sender_connection_id"`
+	UserId       string       `dynamodbav:"user_id" json:"sender_user_id"`
+	DisplayName  string       `dynamodbav:"display_name" json:"sender_display_name"`
+	Text         string       `dynamodbav:"text" json:"text"`
+	Attachments  []Attachment `dynamodbav:"attachments,omitempty" json:"attachments,omitempty"`
+	CreatedAt    int64        `dynamodbav:"created_at" json:"created_at"`
+	EditedAt     int64        `dynamodbav:"edited_at,omitempty" json:"edited_at,omitempty"`
+	ParentId     string       `dynamodbav:"parent_id,omitempty" json:"parent_id,omitempty"`
+	ReplyCount   int          `dynamodbav:"reply_count,omitempty" json:"reply_count"`
+	LastReplyAt  int64        `dynamodbav:"last_reply_at,omitempty" json:"last_reply_at,omitempty"`
+	Deleted      bool         `dynamodbav:"deleted,omitempty" json:"deleted"`
+	TTL          int64        `dynamodbav:"ttl" json:"-"`
+
+	Reactions      Reactions       `dynamodbav:"reactions" json:"-"`
+	ReactionCounts []ReactionCount `dynamodbav:"-" json:"reactions,omitempty"`
+}
+
+// ForPrincipal fills in the reaction counts as the given principal sees them.
+func (message Message) ForPrincipal(principal string) Message {
+	message.ReactionCounts = message.Reactions.Counts(principal)
+	return message
+}
+
+func (message Message) IsAuthor(connectionId string, userId string) bool {
+	if message.UserId != "" {
+		return message.UserId == userId
+	}
+	return message.ConnectionId == connectionId
+}
+
+func (message Message) GetKey() map[string]types.AttributeValue {
+	callId, err := attributevalue.Marshal(message.CallId)
+	if err != nil {
+		panic(err)
+	}
+	messageId, err := attributevalue.Marshal(message.MessageId)
+	if err != nil {
+		panic(err)
+	}
+
+	return map[string]types.AttributeValue{"call_id": callId, "message_id": messageId}
+}
+
+// NewMessageId returns an id that sorts lexically in the order messages were
+// created: the creation time in milliseconds followed by random bits to keep
+// messages sent in the same millisecond apart.
+func NewMessageId(t time.Time) string {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("%012x%s", t.UnixMilli(), hex.EncodeToString(suffix))
+}
+
+var messageIdPattern = regexp.MustCompile(`^[0-9a-f]{28}$`)
+
+// MessageIdTime returns the time a message id was created at.
+func MessageIdTime(messageId string) (time.Time, error) {
+	if !messageIdPattern.MatchString(messageId) {
+		return time.Time{}, fmt.Errorf("invalid message id %v", messageId)
+	}
+	milliseconds, err := strconv.ParseInt(messageId[:12], 16, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid message id %v", messageId)
+	}
+	return time.UnixMilli(milliseconds), nil
+}
+
+// MessagePage is one page of a call's history in chronological order. Before
+// and After are the cursors of the pages either side of it.
+type MessagePage struct {
+	Messages []Message `json:"messages"`
+	Before   string    `json:"before,omitempty"`
+	After    string    `json:"after,omitempty"`
+	HasMore  bool      `json:"has_more"`
+}
+
+func (page MessagePage) ForPrincipal(principal string) MessagePage {
+	for index, message := range page.Messages {
+		page.Messages[index] = message.ForPrincipal(principal)
+	}
+	return page
+}
+
+type MessageDatabase struct {
+	Client    *dynamodb.Client
+	TableName string
+}
+
+func (db MessageDatabase) CreateMessage(ctx context.Context, message Message) error {
+	if message.Reactions == nil {
+		message.Reactions = Reactions{}
+	}
+	item, err := attributevalue.MarshalMap(message)
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = db.Client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(db.TableName),
+		Item:      item,
+	})
+
+	if err != nil {
+		log.Printf("Item could not be added, %v", err)
+	}
+	return err
+}
+
+func (db MessageDatabase) GetMessage(ctx context.Context, callId string, messageId string) (Message, error) {
+	message := Message{CallId: callId, MessageId: messageId}
+	response, err := db.Client.GetItem(ctx, &dynamodb.GetItemInput{
+		Key:       message.GetKey(),
+		TableName: aws.String(db.TableName),
+	})
+	if err != nil {
+		log.Printf("Item could not be got, %v", err)
+	} else if response.Item == nil {
+		err = Errorf(MessageNotFound, "message %v not found in call %v", messageId, callId)
+	} else {
+		err = attributevalue.UnmarshalMap(response.Item, &message)
+		if err != nil {
+			log.Printf("Failed to Unmarshal Item, %v", err)
+		}
+	}
+	return message, err
+}
+
+// BatchGetMessages gets up to 100 messages of a call at once. Messages that
+// do not exist are left out and the rest come back in no particular order.
+func (db MessageDatabase) BatchGetMessages(ctx context.Context, callId string, messageIds []string) ([]Message, error) {
+	messages := []Message{}
+
+	keys := []map[string]types.AttributeValue{}
+	for _, messageId := range messageIds {
+		keys = append(keys, Message{CallId: callId, MessageId: messageId}.GetKey())
+	}
+
+	for len(keys) > 0 {
+		var batch []Message
+
+		response, err := db.Client.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+			RequestItems: map[string]types.KeysAndAttributes{db.TableName: {Keys: keys}},
+		})
+		if err != nil {
+			log.Printf("Items could not be got, %v", err)
+			return messages, err
+		}
+
+		err = attributevalue.UnmarshalListOfMaps(response.Responses[db.TableName], &batch)
+		if err != nil {
+			log.Printf("Failed to Unmarshal Items, %v", err)
+			return messages, err
+		}
+		messages = append(messages, batch...)
+
+		keys = response.UnprocessedKeys[db.TableName].Keys
+	}
+	return messages, nil
+}
+
+// GetMessages pages through the history of a call, leaving out thread
+// replies. With an after cursor it walks forwards from that message, otherwise
+// it walks backwards from the before cursor or from the latest message.
+func (db MessageDatabase) GetMessages(ctx context.Context, callId string, before string, after string, limit int) (MessagePage, error) {
+	topLevel := expression.AttributeNotExists(expression.Name("parent_id"))
+	return db.queryPage(ctx, nil, expression.Key("call_id").Equal(expression.Value(callId)), &topLevel, before, after, limit)
+}
+
+// GetThread pages through the replies to a message the same way GetMessages
+// pages through a call.
+func (db MessageDatabase) GetThread(ctx context.Context, parentId string, before string, after string, limit int) (MessagePage, error) {
+	return db.queryPage(ctx, aws.String(dyscordconfig.THREAD_INDEXNAME), expression.Key("parent_id").Equal(expression.Value(parentId)), nil, before, after, limit)
+}
+
+func (db MessageDatabase) queryPage(ctx context.Context, indexName *string, partition expression.KeyConditionBuilder, filter *expression.ConditionBuilder, before string, after string, limit int) (MessagePage, error) {
+	page := MessagePage{Messages: []Message{}}
+
+	if limit <= 0 {
+		limit = DefaultMessagePage
+	}
+	limit = min(limit, MaxMessagePage)
+
+	keyCondition := partition
+	switch {
+	case before != "" && after != "":
+		keyCondition = keyCondition.And(expression.Key("message_id").Between(expression.Value(after), expression.Value(before)))
+	case before != "":
+		keyCondition = keyCondition.And(expression.Key("message_id").LessThan(expression.Value(before)))
+	case after != "":
+		keyCondition = keyCondition.And(expression.Key("message_id").GreaterThan(expression.Value(after)))
+	}
+	forwards := after != ""
+
+	builder := expression.NewBuilder().WithKeyCondition(keyCondition)
+	if filter != nil {
+		builder = builder.WithFilter(*filter)
+	}
+	expr, err := builder.Build()
+	if err != nil {
+		log.Printf("Item could not build expression, %v", err)
+		return page, err
+	}
+
+	// a filter is applied after the limit, so keep reading until the page is
+	// full or the history runs out
+	var startKey map[string]types.AttributeValue
+	for {
+		var messages []Message
+
+		response, err := db.Client.Query(ctx, &dynamodb.QueryInput{
+			TableName:                 aws.String(db.TableName),
+			IndexName:                 indexName,
+			KeyConditionExpression:    expr.KeyCondition(),
+			FilterExpression:          expr.Filter(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			ScanIndexForward:          aws.Bool(forwards),
+			Limit:                     aws.Int32(int32(limit)),
+			ExclusiveStartKey:         startKey,
+		})
+		if err != nil {
+			log.Printf("Items could not be queried, %v", err)
+			return page, err
+		}
+
+		err = attributevalue.UnmarshalListOfMaps(response.Items, &messages)
+		if err != nil {
+			log.Printf("Failed to Unmarshal Items, %v", err)
+			return page, err
+		}
+
+		// between is inclusive, cursors are not
+		page.Messages = append(page.Messages, slices.DeleteFunc(messages, func(message Message) bool {
+			return message.MessageId == before || message.MessageId == after
+		})...)
+
+		startKey = response.LastEvaluatedKey
+		if startKey == nil || len(page.Messages) >= limit {
+			break
+		}
+	}
+
+	page.HasMore = startKey != nil || len(page.Messages) > limit
+	page.Messages = page.Messages[:min(len(page.Messages), limit)]
+	if !forwards {
+		slices.Reverse(page.Messages)
+	}
+
+	if len(page.Messages) > 0 {
+		page.Before = page.Messages[0].MessageId
+		page.After = page.Messages[len(page.Messages)-1].MessageId
+	}
+	return page, nil
+}
+
+// EditMessage replaces the text of a message that has not been deleted.
+func (db MessageDatabase) EditMessage(ctx context.Context, message Message, text string, editedAt time.Time) (Message, error) {
+	update := expression.Set(expression.Name("text"), expression.Value(text)).
+		Set(expression.Name("edited_at"), expression.Value(editedAt.UnixMilli()))
+
+	return db.updateMessage(ctx, message, update)
+}
+
+// DeleteMessage leaves a tombstone in place of a message, so the history and
+// any replies around it keep their place.
+func (db MessageDatabase) DeleteMessage(ctx context.Context, message Message, deletedAt time.Time) (Message, error) {
+	update := expression.Set(expression.Name("text"), expression.Value("")).
+		Set(expression.Name("deleted"), expression.Value(true)).
+		Set(expression.Name("edited_at"), expression.Value(deletedAt.UnixMilli())).
+		Remove(expression.Name("attachments"))
+
+	return db.updateMessage(ctx, message, update)
+}
+
+// CreateReply stores a reply and counts it against the message it answers in
+// one transaction, so a reply that could not be stored is never counted. Only
+// top level messages that have not been deleted can be replied to. The
+// parent is returned with its new count when it could be read back.
+func (db MessageDatabase) CreateReply(ctx context.Context, reply Message, repliedAt time.Time) (Message, error) {
+	parent := Message{CallId: reply.CallId, MessageId: reply.ParentId}
+
+	if reply.Reactions == nil {
+		reply.Reactions = Reactions{}
+	}
+	item, err := attributevalue.MarshalMap(reply)
+	if err != nil {
+		panic(err)
+	}
+
+	update := expression.Add(expression.Name("reply_count"), expression.Value(1)).
+		Set(expression.Name("last_reply_at"), expression.Value(repliedAt.UnixMilli()))
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(liveMessage(expression.AttributeNotExists(expression.Name("parent_id")))).Build()
+	if err != nil {
+		log.Printf("Item could not build expression, %v", err)
+		return parent, err
+	}
+
+	_, err = db.Client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Put: &types.Put{
+				TableName: aws.String(db.TableName),
+				Item:      item,
+			}},
+			{Update: &types.Update{
+				TableName:                 aws.String(db.TableName),
+				Key:                       parent.GetKey(),
+				ExpressionAttributeNames:  expr.Names(),
+				ExpressionAttributeValues: expr.Values(),
+				UpdateExpression:          expr.Update(),
+				ConditionExpression:       expr.Condition(),
+			}},
+		},
+	})
+
+	var canceled *types.TransactionCanceledException
+	if errors.As(err, &canceled) && len(canceled.CancellationReasons) > 1 && aws.ToString(canceled.CancellationReasons[1].Code) == "ConditionalCheckFailed" {
+		return parent, Errorf(MessageNotFound, "message %v not found in call %v", parent.MessageId, parent.CallId)
+	}
+	if err != nil {
+		log.Printf("Items could not be written, %v", err)
+		return parent, err
+	}
+
+	// the reply is stored, not knowing the new count only costs the push of it
+	updated, err := db.GetMessage(ctx, parent.CallId, parent.MessageId)
+	if err != nil {
+		return parent, nil
+	}
+	return updated, nil
+}
+
+// liveMessage is the condition for changing a message, it has to exist and
+// not be deleted.
+func liveMessage(conditions ...expression.ConditionBuilder) expression.ConditionBuilder {
+	return expression.And(
+		expression.AttributeExists(expression.Name("message_id")),
+		expression.Or(
+			expression.AttributeNotExists(expression.Name("deleted")),
+			expression.Name("deleted").Equal(expression.Value(false)),
+		),
+		conditions...,
+	)
+}
+
+func (db MessageDatabase) updateMessage(ctx context.Context, message Message, update expression.UpdateBuilder, conditions ...expression.ConditionBuilder) (Message, error) {
+	var updated Message
+
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(liveMessage(conditions...)).Build()
+	if err != nil {
+		log.Printf("Item could not build expression, %v", err)
+		return updated, err
+	}
+
+	response, err := db.Client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(db.TableName),
+		Key:                       message.GetKey(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ReturnValues:              types.ReturnValueAllNew,
+	})
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return updated, Errorf(MessageNotFound, "message %v not found in call %v", message.MessageId, message.CallId)
+	}
+	if err != nil {
+		log.Printf("Item could not be updated, %v", err)
+		return updated, err
+	}
+
+	err = attributevalue.UnmarshalMap(response.Attributes, &updated)
+	if err != nil {
+		log.Printf("Unable to unmarshal map, %v", err)
+	}
+	return updated, err
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestNewMessageIdSortsByTime(t *testing.T) {
+	base := time.UnixMilli(1_700_000_000_000)
+	times := []time.Time{
+		base,
+		base.Add(time.Millisecond),
+		base.Add(time.Second),
+		base.Add(24 * time.Hour),
+		time.UnixMilli(0x0fffffffffff),
+	}
+
+	ids := []string{}
+	for _, at := range times {
+		ids = append(ids, NewMessageId(at))
+	}
+	if !slices.IsSorted(ids) {
+		t.Fatalf("ids do not sort by time, %q", ids)
+	}
+	for _, id := range ids {
+		if !messageIdPattern.MatchString(id) {
+			t.Fatalf("id %q does not match the schema", id)
+		}
+	}
+}
+
+func TestNewMessageIdKeepsTheSameMillisecondApart(t *testing.T) {
+	now := time.UnixMilli(1_700_000_000_000)
+	if NewMessageId(now) == NewMessageId(now) {
+		t.Fatal("expected ids of the same millisecond to differ")
+	}
+}
+
+func TestMessageIdTime(t *testing.T) {
+	now := time.UnixMilli(1_700_000_000_123)
+	created, err := MessageIdTime(NewMessageId(now))
+	if err != nil || !created.Equal(now) {
+		t.Fatalf("MessageIdTime = %v, %v, expected %v", created, err, now)
+	}
+
+	malformed := []string{
+		"",
+		"018bcfe56800",
+		"018bcfe5680g0123456789abcdef",
+		"018BCFE568000123456789ABCDEF",
+		"-18bcfe568000123456789abcdef",
+		"018bcfe568000123456789abcdef0",
+		" 18bcfe568000123456789abcdef",
+	}
+	for _, messageId := range malformed {
+		if _, err := MessageIdTime(messageId); err == nil {
+			t.Errorf("expected %q to be rejected", messageId)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package services
+
+const (
+	ParticipantJoined  = "participantJoined"
+	ParticipantLeft    = "participantLeft"
+	ParticipantUpdated = "participantUpdated"
+)
+
+// ParticipantEvent tells the participants of a call about a change to one of
+// their peers. Peers that joined or were updated come with who they are,
+// peers that left only with their connection.
+type ParticipantEvent struct {
+	CallId       string `json:"call_id"`
+	ConnectionId string `json:"connection_id"`
+	Participant  *Peer  `json:"participant,omitempty"`
+}
+
+// ParticipantDiff is what changed about the participants of a call between
+// two images of it.
+type ParticipantDiff struct {
+	Joined  []SDP
+	Left    []SDP
+	Updated []SDP
+}
+
+// Empty is true when no participant joined, left or changed, like when only
+// the call itself was updated.
+func (diff ParticipantDiff) Empty() bool {
+	return len(diff.Joined) == 0 && len(diff.Left) == 0 && len(diff.Updated) == 0
+}
+
+// DiffParticipants compares the participants of a call before and after a
+// change, by connection. A participant is updated when anything about its
+// session description changed, renegotiations included.
+func DiffParticipants(oldCall Call, newCall Call) ParticipantDiff {
+	var diff ParticipantDiff
+	for _, sdp := range newCall.ConnectionSdps {
+		previous, _, found := oldCall.GetSDP(sdp.ConnectionId)
+		if !found {
+			diff.Joined = append(diff.Joined, sdp)
+		} else if previous != sdp {
+			diff.Updated = append(diff.Updated, sdp)
+		}
+	}
+	for _, sdp := range oldCall.ConnectionSdps {
+		if !newCall.HasConnection(sdp.ConnectionId) {
+			diff.Left = append(diff.Left, sdp)
+		}
+	}
+	return diff
+}
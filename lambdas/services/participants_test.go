@@ -0,0 +1,57 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffParticipants(t *testing.T) {
+	ada := SDP{ConnectionId: "ada", NegotiationId: 1, UserId: "user-ada", DisplayName: "Ada"}
+	bob := SDP{ConnectionId: "bob", NegotiationId: 1, UserId: "user-bob", DisplayName: "Bob"}
+	renegotiated := ada
+	renegotiated.NegotiationId = 2
+	renamed := bob
+	renamed.DisplayName = "Robert"
+
+	call := func(sdps ...SDP) Call {
+		return Call{CallId: "aaaaaa", ConnectionSdps: sdps}
+	}
+
+	tests := []struct {
+		name    string
+		oldCall Call
+		newCall Call
+		diff    ParticipantDiff
+	}{
+		{"unchanged", call(ada, bob), call(ada, bob), ParticipantDiff{}},
+		{"first to join", call(), call(ada), ParticipantDiff{Joined: []SDP{ada}}},
+		{"joined", call(ada), call(ada, bob), ParticipantDiff{Joined: []SDP{bob}}},
+		{"left", call(ada, bob), call(ada), ParticipantDiff{Left: []SDP{bob}}},
+		{"last to leave", call(ada), call(), ParticipantDiff{Left: []SDP{ada}}},
+		{"renegotiated", call(ada, bob), call(renegotiated, bob), ParticipantDiff{Updated: []SDP{renegotiated}}},
+		{"renamed", call(ada, bob), call(ada, renamed), ParticipantDiff{Updated: []SDP{renamed}}},
+		{"reordered", call(ada, bob), call(bob, ada), ParticipantDiff{}},
+		{
+			"joined, left and updated at once",
+			call(ada, bob),
+			call(renegotiated, SDP{ConnectionId: "cyd", NegotiationId: 1}),
+			ParticipantDiff{
+				Joined:  []SDP{{ConnectionId: "cyd", NegotiationId: 1}},
+				Left:    []SDP{bob},
+				Updated: []SDP{renegotiated},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diff := DiffParticipants(test.oldCall, test.newCall)
+			if !reflect.DeepEqual(diff, test.diff) {
+				t.Errorf("DiffParticipants = %+v, expected %+v", diff, test.diff)
+			}
+			if empty := test.diff.Joined == nil && test.diff.Left == nil && test.diff.Updated == nil; diff.Empty() != empty {
+				t.Errorf("Empty() = %v, expected %v", diff.Empty(), empty)
+			}
+		})
+	}
+}
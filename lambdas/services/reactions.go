@@ -0,0 +1,236 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+const MaxEmojiLength = 64
+
+// Reactions maps an emoji to the principals that reacted with it. It is stored
+// as a map of string sets so reactions can be added and removed atomically.
+type Reactions map[string][]string
+
+var (
+	_ attributevalue.Marshaler   = Reactions{}
+	_ attributevalue.Unmarshaler = &Reactions{}
+)
+
+func (reactions Reactions) MarshalDynamoDBAttributeValue() (types.AttributeValue, error) {
+	value := map[string]types.AttributeValue{}
+	for emoji, principals := range reactions {
+		if len(principals) > 0 {
+			value[emoji] = &types.AttributeValueMemberSS{Value: principals}
+		}
+	}
+	return &types.AttributeValueMemberM{Value: value}, nil
+}
+
+func (reactions *Reactions) UnmarshalDynamoDBAttributeValue(value types.AttributeValue) error {
+	m, ok := value.(*types.AttributeValueMemberM)
+	if !ok {
+		return fmt.Errorf("reactions must be a map, got %T", value)
+	}
+	*reactions = Reactions{}
+	for emoji, principals := range m.Value {
+		set, ok := principals.(*types.AttributeValueMemberSS)
+		if !ok {
+			return fmt.Errorf("reactions to %v must be a string set, got %T", emoji, principals)
+		}
+		(*reactions)[emoji] = set.Value
+	}
+	return nil
+}
+
+// ReactionCount is what a client sees of the reactions with one emoji.
+type ReactionCount struct {
+	Emoji       string `json:"emoji"`
+	Count       int    `json:"count"`
+	ReactedByMe bool   `json:"reacted_by_me"`
+}
+
+// Counts aggregates the reactions as seen by the given principal, ordered by
+// emoji so clients render them stably.
+func (reactions Reactions) Counts(principal string) []ReactionCount {
+	counts := []ReactionCount{}
+	for emoji, principals := range reactions {
+		if len(principals) == 0 {
+			continue
+		}
+		counts = append(counts, ReactionCount{
+			Emoji:       emoji,
+			Count:       len(principals),
+			ReactedByMe: slices.Contains(principals, principal),
+		})
+	}
+	slices.SortFunc(counts, func(a, b ReactionCount) int {
+		return strings.Compare(a.Emoji, b.Emoji)
+	})
+	return counts
+}
+
+const (
+	zeroWidthJoiner   = '\u200d'
+	variationSelector = '\ufe0f'
+	combiningKeycap   = '\u20e3'
+	cancelTag         = '\U000e007f'
+)
+
+// pictographs are the characters an emoji starts with, roughly Unicode's
+// Extended_Pictographic without the regional indicators and skin tones, which
+// only make up emoji together with others.
+var pictographs = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x00a9, Hi: 0x00ae, Stride: 5},
+		{Lo: 0x203c, Hi: 0x2049, Stride: 13},
+		{Lo: 0x2122, Hi: 0x2139, Stride: 23},
+		{Lo: 0x2194, Hi: 0x2199, Stride: 1},
+		{Lo: 0x21a9, Hi: 0x21aa, Stride: 1},
+		{Lo: 0x231a, Hi: 0x231b, Stride: 1},
+		{Lo: 0x2328, Hi: 0x23cf, Stride: 167},
+		{Lo: 0x23e9, Hi: 0x23f3, Stride: 1},
+		{Lo: 0x23f8, Hi: 0x23fa, Stride: 1},
+		{Lo: 0x24c2, Hi: 0x24c2, Stride: 1},
+		{Lo: 0x25aa, Hi: 0x25ab, Stride: 1},
+		{Lo: 0x25b6, Hi: 0x25c0, Stride: 10},
+		{Lo: 0x25fb, Hi: 0x25fe, Stride: 1},
+		{Lo: 0x2600, Hi: 0x27bf, Stride: 1},
+		{Lo: 0x2934, Hi: 0x2935, Stride: 1},
+		{Lo: 0x2b05, Hi: 0x2b07, Stride: 1},
+		{Lo: 0x2b1b, Hi: 0x2b1c, Stride: 1},
+		{Lo: 0x2b50, Hi: 0x2b55, Stride: 5},
+		{Lo: 0x3030, Hi: 0x303d, Stride: 13},
+		{Lo: 0x3297, Hi: 0x3299, Stride: 2},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x1f000, Hi: 0x1f1e5, Stride: 1},
+		{Lo: 0x1f200, Hi: 0x1f3fa, Stride: 1},
+		{Lo: 0x1f400, Hi: 0x1faff, Stride: 1},
+		{Lo: 0x1fc00, Hi: 0x1fffd, Stride: 1},
+	},
+	LatinOffset: 1,
+}
+
+func isSkinTone(r rune) bool {
+	return r >= 0x1f3fb && r <= 0x1f3ff
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1f1e6 && r <= 0x1f1ff
+}
+
+func isTag(r rune) bool {
+	return r >= 0xe0020 && r <= 0xe007e
+}
+
+// ValidEmoji accepts a single emoji: a keycap, a flag, or pictographs with
+// their presentation selectors, skin tones and tags, joined by zero width
+// joiners into one, like 👩🏽‍💻. Text, several emoji in a row and anything
+// that would be read as a document path are rejected.
+func ValidEmoji(emoji string) bool {
+	if emoji == "" || len(emoji) > MaxEmojiLength || !utf8.ValidString(emoji) {
+		return false
+	}
+	runes := []rune(emoji)
+
+	if len(runes) == 2 && isRegionalIndicator(runes[0]) && isRegionalIndicator(runes[1]) {
+		return true
+	}
+	if last := len(runes) - 1; runes[last] == combiningKeycap && strings.ContainsRune("0123456789#*", runes[0]) {
+		return len(runes) == 2 || (len(runes) == 3 && runes[1] == variationSelector)
+	}
+
+	for i := 0; ; i++ {
+		if i == len(runes) || !unicode.Is(pictographs, runes[i]) {
+			return false
+		}
+		i++
+		if i < len(runes) && runes[i] == variationSelector {
+			i++
+		}
+		if i < len(runes) && isSkinTone(runes[i]) {
+			i++
+		}
+		if i < len(runes) && isTag(runes[i]) {
+			for i < len(runes) && isTag(runes[i]) {
+				i++
+			}
+			if i == len(runes) || runes[i] != cancelTag {
+				return false
+			}
+			i++
+		}
+		if i == len(runes) {
+			return true
+		}
+		if runes[i] != zeroWidthJoiner {
+			return false
+		}
+	}
+}
+
+func (db MessageDatabase) AddReaction(ctx context.Context, message Message, emoji string, principal string) (Message, error) {
+	update := expression.Add(expression.Name("reactions."+emoji), expression.Value(&types.AttributeValueMemberSS{Value: []string{principal}}))
+	return db.updateReactions(ctx, message, update)
+}
+
+func (db MessageDatabase) RemoveReaction(ctx context.Context, message Message, emoji string, principal string) (Message, error) {
+	update := expression.Delete(expression.Name("reactions."+emoji), expression.Value(&types.AttributeValueMemberSS{Value: []string{principal}}))
+	return db.updateReactions(ctx, message, update)
+}
+
+func (db MessageDatabase) updateReactions(ctx context.Context, message Message, update expression.UpdateBuilder) (Message, error) {
+	updated, err := db.updateMessage(ctx, message, update)
+
+	// messages stored before reactions existed have no map to update into
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "ValidationException" {
+		if err = db.initReactions(ctx, message); err != nil {
+			return updated, err
+		}
+		updated, err = db.updateMessage(ctx, message, update)
+	}
+	return updated, err
+}
+
+func (db MessageDatabase) initReactions(ctx context.Context, message Message) error {
+	update := expression.Set(expression.Name("reactions"), expression.Value(&types.AttributeValueMemberM{Value: map[string]types.AttributeValue{}}))
+	condition := expression.AttributeNotExists(expression.Name("reactions"))
+
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		log.Printf("Item could not build expression, %v", err)
+		return err
+	}
+
+	_, err = db.Client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(db.TableName),
+		Key:                       message.GetKey(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+	})
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return nil
+	}
+	if err != nil {
+		log.Printf("Item could not be updated, %v", err)
+	}
+	return err
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestValidEmoji(t *testing.T) {
+	tests := []struct {
+		emoji string
+		valid bool
+	}{
+		{"👍", true},
+		{"❤️", true},
+		{"❤", true},
+		{"©️", true},
+		{"👍🏽", true},
+		{"👩‍💻", true},
+		{"👩🏽‍💻", true},
+		{"👨‍👩‍👧‍👦", true},
+		{"🏳️‍🌈", true},
+		{"🇩🇪", true},
+		{"1️⃣", true},
+		{"#⃣", true},
+		{"🏴󠁧󠁢󠁳󠁣󠁴󠁿", true},
+		{"", false},
+		{"a", false},
+		{"ok", false},
+		{"1", false},
+		{"é", false},
+		{"👍👍", false},
+		{"👍 ", false},
+		{" 👍", false},
+		{"🇩🇪🇫", false},
+		{"🇩", false},
+		{"👩‍", false},
+		{"‍💻", false},
+		{"👍a", false},
+		{"🏴󠁧󠁢", false},
+		{"👍.x", false},
+		{"[0]", false},
+		{"‍", false},
+		{"\xff", false},
+	}
+
+	for _, test := range tests {
+		if valid := ValidEmoji(test.emoji); valid != test.valid {
+			t.Errorf("ValidEmoji(%q) = %v, expected %v", test.emoji, valid, test.valid)
+		}
+	}
+}
+
+func TestReactionCounts(t *testing.T) {
+	reactions := Reactions{
+		"👍": {"user-ada", "user-bob"},
+		"🎉": {"user-bob"},
+		"😢": {},
+	}
+
+	tests := []struct {
+		principal string
+		counts    []ReactionCount
+	}{
+		{"user-ada", []ReactionCount{{Emoji: "🎉", Count: 1}, {Emoji: "👍", Count: 2, ReactedByMe: true}}},
+		{"user-bob", []ReactionCount{{Emoji: "🎉", Count: 1, ReactedByMe: true}, {Emoji: "👍", Count: 2, ReactedByMe: true}}},
+		{"user-cyd", []ReactionCount{{Emoji: "🎉", Count: 1}, {Emoji: "👍", Count: 2}}},
+	}
+
+	for _, test := range tests {
+		if counts := reactions.Counts(test.principal); !reflect.DeepEqual(counts, test.counts) {
+			t.Errorf("Counts(%v) = %+v, expected %+v", test.principal, counts, test.counts)
+		}
+	}
+
+	if counts := (Reactions{}).Counts("user-ada"); counts == nil || len(counts) != 0 {
+		t.Errorf("expected no counts, got %#v", counts)
+	}
+}
+
+func TestReactionsMarshalling(t *testing.T) {
+	value, err := attributevalue.Marshal(Reactions{"👍": {"user-ada"}, "😢": {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+		"👍": &types.AttributeValueMemberSS{Value: []string{"user-ada"}},
+	}}
+	if !reflect.DeepEqual(value, expected) {
+		t.Fatalf("marshalled %#v, expected empty sets to be left out", value)
+	}
+
+	var reactions Reactions
+	if err = attributevalue.Unmarshal(value, &reactions); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reactions, Reactions{"👍": {"user-ada"}}) {
+		t.Fatalf("unmarshalled %v", reactions)
+	}
+}
+
+func TestReactionsUnmarshalling(t *testing.T) {
+	tests := []struct {
+		name  string
+		value types.AttributeValue
+		ok    bool
+	}{
+		{"empty map", &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{}}, true},
+		{"not a map", &types.AttributeValueMemberS{Value: "👍"}, false},
+		{"not a string set", &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+			"👍": &types.AttributeValueMemberL{Value: []types.AttributeValue{&types.AttributeValueMemberS{Value: "user-ada"}}},
+		}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var reactions Reactions
+			err := attributevalue.Unmarshal(test.value, &reactions)
+			if test.ok && err != nil {
+				t.Fatalf("expected the value to unmarshal, %v", err)
+			}
+			if !test.ok && err == nil {
+				t.Fatalf("expected the value to be rejected, got %v", reactions)
+			}
+		})
+	}
+}
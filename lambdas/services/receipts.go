@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ReadMarker is the last message a principal has read in a call. It is kept
+// per principal rather than per connection so every device agrees on it.
+type ReadMarker struct {
+	Principal         string `dynamodbav:"principal" json:"-"`
+	CallId            string `dynamodbav:"call_id" json:"call_id"`
+	LastReadMessageId string `dynamodbav:"last_read_message_id" json:"last_read_message_id"`
+	UpdatedAt         int64  `dynamodbav:"updated_at" json:"updated_at"`
+	UnreadCount       int    `dynamodbav:"-" json:"unread_count"`
+	TTL               int64  `dynamodbav:"ttl" json:"-"`
+}
+
+func (marker ReadMarker) GetKey() map[string]types.AttributeValue {
+	principal, err := attributevalue.Marshal(marker.Principal)
+	if err != nil {
+		panic(err)
+	}
+	callId, err := attributevalue.Marshal(marker.CallId)
+	if err != nil {
+		panic(err)
+	}
+
+	return map[string]types.AttributeValue{"principal": principal, "call_id": callId}
+}
+
+type ReceiptDatabase struct {
+	Client    *dynamodb.Client
+	TableName string
+}
+
+// Advance moves a read marker forwards. It reports false, without an error,
+// when the marker is already at or past the given message, so acks arriving
+// out of order from several devices never move it back.
+func (db ReceiptDatabase) Advance(ctx context.Context, marker ReadMarker) (bool, error) {
+	update := expression.Set(expression.Name("last_read_message_id"), expression.Value(marker.LastReadMessageId)).
+		Set(expression.Name("updated_at"), expression.Value(marker.UpdatedAt)).
+		Set(expression.Name("ttl"), expression.Value(marker.TTL))
+	condition := expression.Or(
+		expression.AttributeNotExists(expression.Name("last_read_message_id")),
+		expression.Name("last_read_message_id").LessThan(expression.Value(marker.LastReadMessageId)),
+	)
+
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		log.Printf("Item could not build expression, %v", err)
+		return false, err
+	}
+
+	_, err = db.Client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(db.TableName),
+		Key:                       marker.GetKey(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+	})
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return false, nil
+	}
+	if err != nil {
+		log.Printf("Item could not be updated, %v", err)
+		return false, err
+	}
+	return true, nil
+}
+
+func (db ReceiptDatabase) GetMarker(ctx context.Context, principal string, callId string) (ReadMarker, error) {
+	marker := ReadMarker{Principal: principal, CallId: callId}
+	response, err := db.Client.GetItem(ctx, &dynamodb.GetItemInput{
+		Key:       marker.GetKey(),
+		TableName: aws.String(db.TableName),
+	})
+	if err != nil {
+		log.Printf("Item could not be got, %v", err)
+	} else {
+		err = attributevalue.UnmarshalMap(response.Item, &marker)
+		if err != nil {
+			log.Printf("Failed to Unmarshal Item, %v", err)
+		}
+	}
+	return marker, err
+}
+
+func (db ReceiptDatabase) GetMarkers(ctx context.Context, principal string) ([]ReadMarker, error) {
+	markers := []ReadMarker{}
+
+	keyCondition := expression.Key("principal").Equal(expression.Value(principal))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCondition).Build()
+	if err != nil {
+		log.Printf("Item could not build expression, %v", err)
+		return markers, err
+	}
+
+	paginator := dynamodb.NewQueryPaginator(db.Client, &dynamodb.QueryInput{
+		TableName:                 aws.String(db.TableName),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+	for paginator.HasMorePages() {
+		var page []ReadMarker
+
+		response, err := paginator.NextPage(ctx)
+		if err != nil {
+			log.Printf("Items could not be queried, %v", err)
+			return markers, err
+		}
+		err = attributevalue.UnmarshalListOfMaps(response.Items, &page)
+		if err != nil {
+			log.Printf("Failed to Unmarshal Items, %v", err)
+			return markers, err
+		}
+		markers = append(markers, page...)
+	}
+	return markers, nil
+}
+
+// CountUnread counts the top level messages of a call after the given one
+// that were not sent by the principal itself.
+func (db MessageDatabase) CountUnread(ctx context.Context, callId string, after string, principal string) (int, error) {
+	keyCondition := expression.Key("call_id").Equal(expression.Value(callId))
+	if after != "" {
+		keyCondition = keyCondition.And(expression.Key("message_id").GreaterThan(expression.Value(after)))
+	}
+	filter := expression.And(
+		expression.AttributeNotExists(expression.Name("parent_id")),
+		expression.Name("user_id").NotEqual(expression.Value(principal)),
+		expression.Name("connection_id").NotEqual(expression.Value(principal)),
+	)
+
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCondition).WithFilter(filter).Build()
+	if err != nil {
+		log.Printf("Item could not build expression, %v", err)
+		return 0, err
+	}
+
+	count := 0
+	paginator := dynamodb.NewQueryPaginator(db.Client, &dynamodb.QueryInput{
+		TableName:                 aws.String(db.TableName),
+		KeyConditionExpression:    expr.KeyCondition(),
+		FilterExpression:          expr.Filter(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		Select:                    types.SelectCount,
+	})
+	for paginator.HasMorePages() {
+		response, err := paginator.NextPage(ctx)
+		if err != nil {
+			log.Printf("Items could not be queried, %v", err)
+			return count, err
+		}
+		count += int(response.Count)
+	}
+	return count, nil
+}
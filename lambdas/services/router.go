@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Actions are the route keys of the WebSocket API that clients can send.
+var Actions = []string{
+	"connectionId",
+	"createCall",
+	"joinCall",
+	"leaveCall",
+	"endCall",
+	"iceCandidate",
+	"signal",
+	"renegotiate",
+	"sendMessage",
+	"getMessages",
+	"getThread",
+	"editMessage",
+	"deleteMessage",
+	"typing",
+	"addReaction",
+	"removeReaction",
+	"ackMessages",
+	"getUnreadCounts",
+	"requestUpload",
+	"searchMessages",
+}
+
+// Handler is the signature every WebSocket route handler shares.
+type Handler func(ctx context.Context, request events.APIGatewayWebsocketProxyRequest) (events.APIGatewayProxyResponse, error)
+
+// ActionError is the error of an envelope.
+type ActionError struct {
+	Code             ErrorCode    `json:"code"`
+	Message          string       `json:"message"`
+	Fields           []FieldError `json:"fields,omitempty"`
+	SupportedActions []string     `json:"supported_actions,omitempty"`
+}
+
+// Router dispatches requests by their action to handlers registered in the
+// same process, so several routes can be served by one Lambda.
+type Router struct {
+	handlers map[string]Handler
+}
+
+func NewRouter() *Router {
+	return &Router{handlers: map[string]Handler{}}
+}
+
+func (router *Router) Handle(action string, handler Handler) {
+	router.handlers[action] = Validated(action, handler)
+}
+
+// Supported lists the actions a client can send, whether API Gateway routes
+// them to their own Lambda or the router handles them in process.
+func (router *Router) Supported() []string {
+	actions := slices.Clone(Actions)
+	for action := range router.handlers {
+		if !slices.Contains(actions, action) {
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+func (router *Router) Route(ctx context.Context, request events.APIGatewayWebsocketProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var envelope struct {
+		Action string `json:"action"`
+	}
+
+	if err := json.Unmarshal([]byte(request.Body), &envelope); err != nil {
+		return RespondError(ctx, request, envelope.Action, ErrInvalidBody)
+	}
+
+	if handler, ok := router.handlers[envelope.Action]; ok {
+		return handler(ctx, request)
+	}
+
+	return respondActionError(ctx, request, envelope.Action, ActionError{
+		Code:             UnknownAction,
+		Message:          fmt.Sprintf("Unknown action %q", envelope.Action),
+		SupportedActions: router.Supported(),
+	})
+}
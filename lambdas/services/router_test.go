@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"dyscord-backend/schemas"
+)
+
+func route(t *testing.T, router *Router, body string) (int, Envelope) {
+	t.Helper()
+	response, err := router.Route(context.Background(), events.APIGatewayWebsocketProxyRequest{Body: body})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var envelope Envelope
+	if err = json.Unmarshal([]byte(response.Body), &envelope); err != nil {
+		t.Fatalf("could not decode %q, %v", response.Body, err)
+	}
+	return response.StatusCode, envelope
+}
+
+func TestRouterUnknownAction(t *testing.T) {
+	router := NewRouter()
+	router.Handle("ping", func(ctx context.Context, request events.APIGatewayWebsocketProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return Respond(ctx, request, "ping", "pong")
+	})
+
+	statusCode, envelope := route(t, router, `{"action": "dance", "request_id": "7"}`)
+
+	if statusCode != UnknownAction.StatusCode() || envelope.Error == nil || envelope.Error.Code != UnknownAction {
+		t.Fatalf("expected unknown_action, got %v %+v", statusCode, envelope)
+	}
+	if envelope.Action != "dance" || envelope.RequestId != "7" {
+		t.Fatalf("expected the action and request id to be echoed, got %+v", envelope)
+	}
+	if !slices.Equal(envelope.Error.SupportedActions, append(slices.Clone(Actions), "ping")) {
+		t.Fatalf("unexpected supported actions %q", envelope.Error.SupportedActions)
+	}
+}
+
+func TestRouterRoutesRegisteredActions(t *testing.T) {
+	router := NewRouter()
+	router.Handle("ping", func(ctx context.Context, request events.APIGatewayWebsocketProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return Respond(ctx, request, "ping", "pong")
+	})
+
+	statusCode, envelope := route(t, router, `{"action": "ping"}`)
+	if statusCode != 200 || envelope.Data != "pong" {
+		t.Fatalf("expected the ping handler to answer, got %v %+v", statusCode, envelope)
+	}
+
+	statusCode, envelope = route(t, router, `not json`)
+	if statusCode != InvalidRequest.StatusCode() || envelope.Error == nil || envelope.Error.Code != InvalidRequest {
+		t.Fatalf("expected invalid_request, got %v %+v", statusCode, envelope)
+	}
+}
+
+// The actions are kept by hand next to the routes of the stack, so they are
+// checked against each other.
+func TestActionsMatchTheStackRoutes(t *testing.T) {
+	stack, err := os.ReadFile("../../dyscord-backend.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes := []string{}
+	for _, match := range regexp.MustCompile(`AddRoute\(jsii\.String\("([^"$]+)"\)`).FindAllSubmatch(stack, -1) {
+		routes = append(routes, string(match[1]))
+	}
+	actions := slices.Clone(Actions)
+	slices.Sort(routes)
+	slices.Sort(actions)
+	if !slices.Equal(routes, actions) {
+		t.Fatalf("the stack routes %q, but Actions lists %q", routes, actions)
+	}
+
+	for _, action := range schemas.Actions() {
+		if !slices.Contains(Actions, action) {
+			t.Errorf("%v has a schema but is not an action", action)
+		}
+	}
+}
@@ -0,0 +1,500 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"math/rand"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	DefaultSearchPage = 20
+	MaxSearchPage     = 50
+
+	snippetLength  = 160
+	snippetContext = 40
+	// DynamoDB limits a batch write to 25 requests
+	maxBatchWrite = 25
+	postingsPage  = 100
+	// MaxWriteAttempts is how often postings left unprocessed are written
+	// again before giving up
+	MaxWriteAttempts = 5
+	writeBackoff     = 50 * time.Millisecond
+	maxWriteBackoff  = time.Second
+)
+
+// SearchIndex finds chat messages by keywords, author and date. Indexes only
+// narrow the search down, the messages they return are the ones stored in
+// the messages table.
+type SearchIndex interface {
+	Index(ctx context.Context, message Message) error
+	Remove(ctx context.Context, message Message) error
+	Search(ctx context.Context, query SearchQuery) (SearchPage, error)
+}
+
+// SearchQuery matches messages of the given calls that contain every keyword
+// of Text. Author is the principal that sent the message, From and To bound
+// its creation time in milliseconds and Before is the cursor of the previous
+// page.
+type SearchQuery struct {
+	CallIds []string
+	Text    string
+	Author  string
+	From    int64
+	To      int64
+	Before  string
+	Limit   int
+}
+
+func (query SearchQuery) keywords() []string {
+	return Tokenize(query.Text)
+}
+
+func (query SearchQuery) limit() int {
+	if query.Limit <= 0 {
+		return DefaultSearchPage
+	}
+	return min(query.Limit, MaxSearchPage)
+}
+
+// bounds returns the range of message ids the query covers, lower inclusive
+// and upper exclusive. Either is empty when the range is open on that side.
+func (query SearchQuery) bounds() (string, string) {
+	var lower, upper string
+	if query.From > 0 {
+		lower = fmt.Sprintf("%012x", query.From)
+	}
+	if query.To > 0 {
+		upper = fmt.Sprintf("%012x", query.To+1)
+	}
+	if query.Before != "" && (upper == "" || query.Before < upper) {
+		upper = query.Before
+	}
+	return lower, upper
+}
+
+// Matches reports whether a message satisfies every part of the query.
+func (query SearchQuery) Matches(message Message) bool {
+	if message.Deleted || !slices.Contains(query.CallIds, message.CallId) {
+		return false
+	}
+	if query.Author != "" && authorOf(message) != query.Author {
+		return false
+	}
+	lower, upper := query.bounds()
+	if message.MessageId < lower || (upper != "" && message.MessageId >= upper) {
+		return false
+	}
+
+	tokens := Tokenize(message.Text)
+	for _, keyword := range query.keywords() {
+		if !slices.Contains(tokens, keyword) {
+			return false
+		}
+	}
+	return true
+}
+
+func (query SearchQuery) validate() error {
+	if len(query.keywords()) == 0 && query.Author == "" {
+		return Errorf(InvalidRequest, "search needs keywords or an author")
+	}
+	return nil
+}
+
+// SearchResult is a matching message with a snippet of its text around the
+// first match. Matches in the snippet are wrapped in <mark> tags and the rest
+// of the text is HTML escaped.
+type SearchResult struct {
+	Message Message `json:"message"`
+	Snippet string  `json:"snippet"`
+}
+
+// SearchPage holds the results newest first. Before is the cursor of the
+// next, older page.
+type SearchPage struct {
+	Results []SearchResult `json:"results"`
+	Before  string         `json:"before,omitempty"`
+	HasMore bool           `json:"has_more"`
+}
+
+func (page SearchPage) ForPrincipal(principal string) SearchPage {
+	for index, result := range page.Results {
+		page.Results[index].Message = result.Message.ForPrincipal(principal)
+	}
+	return page
+}
+
+// Messages returns the messages of the results, sharing their attachments so
+// download URLs can be filled in place.
+func (page SearchPage) Messages() []Message {
+	messages := []Message{}
+	for _, result := range page.Results {
+		messages = append(messages, result.Message)
+	}
+	return messages
+}
+
+// newSearchPage turns the matches of a query into a page, hasMore being set
+// when the index knows of matches past the ones given.
+func newSearchPage(query SearchQuery, matches []Message, hasMore bool) SearchPage {
+	page := SearchPage{Results: []SearchResult{}}
+	limit := query.limit()
+
+	slices.SortFunc(matches, func(a Message, b Message) int {
+		return strings.Compare(b.MessageId, a.MessageId)
+	})
+
+	page.HasMore = hasMore || len(matches) > limit
+	for _, message := range matches[:min(len(matches), limit)] {
+		page.Results = append(page.Results, SearchResult{
+			Message: message,
+			Snippet: Highlight(message.Text, query.keywords()),
+		})
+	}
+
+	if page.HasMore && len(page.Results) > 0 {
+		page.Before = page.Results[len(page.Results)-1].Message.MessageId
+	}
+	return page
+}
+
+type tokenSpan struct {
+	start int
+	end   int
+	token string
+}
+
+func tokenSpans(runes []rune) []tokenSpan {
+	spans := []tokenSpan{}
+	start := -1
+	for index := 0; index <= len(runes); index++ {
+		inToken := index < len(runes) && (unicode.IsLetter(runes[index]) || unicode.IsNumber(runes[index]))
+		if inToken && start < 0 {
+			start = index
+		} else if !inToken && start >= 0 {
+			spans = append(spans, tokenSpan{start, index, strings.ToLower(string(runes[start:index]))})
+			start = -1
+		}
+	}
+	return spans
+}
+
+// Tokenize splits text into the lower cased words it is indexed by, each
+// word listed once.
+func Tokenize(text string) []string {
+	tokens := []string{}
+	for _, span := range tokenSpans([]rune(text)) {
+		if !slices.Contains(tokens, span.token) {
+			tokens = append(tokens, span.token)
+		}
+	}
+	return tokens
+}
+
+// Highlight cuts a snippet out of text around the first keyword it contains
+// and marks every keyword within it.
+func Highlight(text string, keywords []string) string {
+	runes := []rune(text)
+	spans := tokenSpans(runes)
+
+	start := 0
+	if first := slices.IndexFunc(spans, func(span tokenSpan) bool { return slices.Contains(keywords, span.token) }); first >= 0 {
+		start = max(0, spans[first].start-snippetContext)
+	}
+	end := min(len(runes), start+snippetLength)
+	// start the snippet on a word rather than in the middle of one
+	if start > 0 {
+		if next := slices.IndexFunc(spans, func(span tokenSpan) bool { return span.start >= start }); next >= 0 && spans[next].start < end {
+			start = spans[next].start
+		}
+	}
+
+	var snippet strings.Builder
+	if start > 0 {
+		snippet.WriteString("…")
+	}
+	position := start
+	for _, span := range spans {
+		if span.start < start || span.end > end || !slices.Contains(keywords, span.token) {
+			continue
+		}
+		snippet.WriteString(html.EscapeString(string(runes[position:span.start])))
+		snippet.WriteString("<mark>")
+		snippet.WriteString(html.EscapeString(string(runes[span.start:span.end])))
+		snippet.WriteString("</mark>")
+		position = span.end
+	}
+	snippet.WriteString(html.EscapeString(string(runes[position:end])))
+	if end < len(runes) {
+		snippet.WriteString("…")
+	}
+	return snippet.String()
+}
+
+func authorOf(message Message) string {
+	return Principal(message.ConnectionId, message.UserId)
+}
+
+// authorTerm is the term a message is indexed under for its author. Words
+// never contain an @ so it cannot collide with one.
+func authorTerm(principal string) string {
+	return "@" + principal
+}
+
+// MemorySearchIndex keeps the messages it indexes in memory. It is meant for
+// tests and local runs, a Lambda forgets it between cold starts.
+type MemorySearchIndex struct {
+	mutex    sync.Mutex
+	messages map[string]Message
+}
+
+func NewMemorySearchIndex() *MemorySearchIndex {
+	return &MemorySearchIndex{messages: map[string]Message{}}
+}
+
+func (index *MemorySearchIndex) Index(ctx context.Context, message Message) error {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	index.messages[message.MessageId] = message
+	return nil
+}
+
+func (index *MemorySearchIndex) Remove(ctx context.Context, message Message) error {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	delete(index.messages, message.MessageId)
+	return nil
+}
+
+func (index *MemorySearchIndex) Search(ctx context.Context, query SearchQuery) (SearchPage, error) {
+	if err := query.validate(); err != nil {
+		return SearchPage{Results: []SearchResult{}}, err
+	}
+
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	matches := []Message{}
+	for _, message := range index.messages {
+		if query.Matches(message) {
+			matches = append(matches, message)
+		}
+	}
+	return newSearchPage(query, matches, false), nil
+}
+
+// posting records that a message of a call contains a term. Term is the call
+// id and the term joined by a #, so every call has its own postings.
+type posting struct {
+	Term      string `dynamodbav:"term"`
+	MessageId string `dynamodbav:"message_id"`
+	CallId    string `dynamodbav:"call_id"`
+	TTL       int64  `dynamodbav:"ttl"`
+}
+
+func postingTerm(callId string, term string) string {
+	return callId + "#" + term
+}
+
+func (p posting) GetKey() map[string]types.AttributeValue {
+	term, err := attributevalue.Marshal(p.Term)
+	if err != nil {
+		panic(err)
+	}
+	messageId, err := attributevalue.Marshal(p.MessageId)
+	if err != nil {
+		panic(err)
+	}
+
+	return map[string]types.AttributeValue{"term": term, "message_id": messageId}
+}
+
+// DynamoSearchIndex is an inverted index in a DynamoDB table. Candidates are
+// read from the postings of a single term and checked against the stored
+// messages, so edits and deletes never show stale results.
+type DynamoSearchIndex struct {
+	Client    *dynamodb.Client
+	TableName string
+	Messages  MessageDatabase
+}
+
+func postings(message Message) []posting {
+	terms := append(Tokenize(message.Text), authorTerm(authorOf(message)))
+
+	postings := []posting{}
+	for _, term := range terms {
+		postings = append(postings, posting{
+			Term:      postingTerm(message.CallId, term),
+			MessageId: message.MessageId,
+			CallId:    message.CallId,
+			TTL:       message.TTL,
+		})
+	}
+	return postings
+}
+
+func (index DynamoSearchIndex) Index(ctx context.Context, message Message) error {
+	requests := []types.WriteRequest{}
+	for _, p := range postings(message) {
+		item, err := attributevalue.MarshalMap(p)
+		if err != nil {
+			panic(err)
+		}
+		requests = append(requests, types.WriteRequest{PutRequest: &types.PutRequest{Item: item}})
+	}
+	return index.write(ctx, requests)
+}
+
+func (index DynamoSearchIndex) Remove(ctx context.Context, message Message) error {
+	requests := []types.WriteRequest{}
+	for _, p := range postings(message) {
+		requests = append(requests, types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: p.GetKey()}})
+	}
+	return index.write(ctx, requests)
+}
+
+// write writes the postings in batches. Postings DynamoDB left unprocessed,
+// because the table is throttled, are written again with full jitter backoff.
+func (index DynamoSearchIndex) write(ctx context.Context, requests []types.WriteRequest) error {
+	backoff := writeBackoff
+
+	for attempt := 1; ; attempt++ {
+		unprocessed := []types.WriteRequest{}
+		for len(requests) > 0 {
+			batch := requests[:min(len(requests), maxBatchWrite)]
+			requests = requests[len(batch):]
+
+			response, err := index.Client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+				RequestItems: map[string][]types.WriteRequest{index.TableName: batch},
+			})
+			if err != nil {
+				log.Printf("Items could not be written, %v", err)
+				return err
+			}
+			unprocessed = append(unprocessed, response.UnprocessedItems[index.TableName]...)
+		}
+
+		requests = unprocessed
+		if len(requests) == 0 {
+			return nil
+		}
+		if attempt == MaxWriteAttempts {
+			return fmt.Errorf("%v postings were left unprocessed after %v attempts", len(requests), attempt)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(rand.Int63n(int64(backoff)))):
+		}
+		backoff = min(2*backoff, maxWriteBackoff)
+	}
+}
+
+func (index DynamoSearchIndex) Search(ctx context.Context, query SearchQuery) (SearchPage, error) {
+	if err := query.validate(); err != nil {
+		return SearchPage{Results: []SearchResult{}}, err
+	}
+
+	// the longest keyword is likely the rarest and has the fewest postings
+	term := authorTerm(query.Author)
+	if keywords := query.keywords(); len(keywords) > 0 {
+		term = slices.MaxFunc(keywords, func(a string, b string) int { return len(a) - len(b) })
+	}
+
+	matches := []Message{}
+	hasMore := false
+	for _, callId := range query.CallIds {
+		callMatches, more, err := index.searchCall(ctx, callId, term, query)
+		if err != nil {
+			return SearchPage{Results: []SearchResult{}}, err
+		}
+		matches = append(matches, callMatches...)
+		hasMore = hasMore || more
+	}
+	return newSearchPage(query, matches, hasMore), nil
+}
+
+// searchCall walks the postings of a term in a call from the newest message
+// back until it has found more matches than fit on a page.
+func (index DynamoSearchIndex) searchCall(ctx context.Context, callId string, term string, query SearchQuery) ([]Message, bool, error) {
+	matches := []Message{}
+
+	keyCondition := expression.Key("term").Equal(expression.Value(postingTerm(callId, term)))
+	lower, upper := query.bounds()
+	switch {
+	case lower != "" && upper != "":
+		keyCondition = keyCondition.And(expression.Key("message_id").Between(expression.Value(lower), expression.Value(upper)))
+	case lower != "":
+		keyCondition = keyCondition.And(expression.Key("message_id").GreaterThanEqual(expression.Value(lower)))
+	case upper != "":
+		keyCondition = keyCondition.And(expression.Key("message_id").LessThan(expression.Value(upper)))
+	}
+
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCondition).Build()
+	if err != nil {
+		log.Printf("Item could not build expression, %v", err)
+		return matches, false, err
+	}
+
+	var startKey map[string]types.AttributeValue
+	for {
+		var postings []posting
+
+		response, err := index.Client.Query(ctx, &dynamodb.QueryInput{
+			TableName:                 aws.String(index.TableName),
+			KeyConditionExpression:    expr.KeyCondition(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			ScanIndexForward:          aws.Bool(false),
+			Limit:                     aws.Int32(postingsPage),
+			ExclusiveStartKey:         startKey,
+		})
+		if err != nil {
+			log.Printf("Items could not be queried, %v", err)
+			return matches, false, err
+		}
+
+		err = attributevalue.UnmarshalListOfMaps(response.Items, &postings)
+		if err != nil {
+			log.Printf("Failed to Unmarshal Items, %v", err)
+			return matches, false, err
+		}
+
+		messageIds := []string{}
+		for _, p := range postings {
+			messageIds = append(messageIds, p.MessageId)
+		}
+
+		messages, err := index.Messages.BatchGetMessages(ctx, callId, messageIds)
+		if err != nil {
+			return matches, false, err
+		}
+		for _, message := range messages {
+			if query.Matches(message) {
+				matches = append(matches, message)
+			}
+		}
+
+		startKey = response.LastEvaluatedKey
+		if startKey == nil || len(matches) > query.limit() {
+			break
+		}
+	}
+	return matches, startKey != nil, nil
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text   string
+		tokens []string
+	}{
+		{"", []string{}},
+		{"Hello, world!", []string{"hello", "world"}},
+		{"hello HELLO Hello", []string{"hello"}},
+		{"it's 2pm-ish", []string{"it", "s", "2pm", "ish"}},
+		{"Grüße aus Köln", []string{"grüße", "aus", "köln"}},
+		{"  ...  ", []string{}},
+	}
+
+	for _, test := range tests {
+		if tokens := Tokenize(test.text); !slices.Equal(tokens, test.tokens) {
+			t.Errorf("Tokenize(%q) = %q, expected %q", test.text, tokens, test.tokens)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	long := strings.Repeat("filler ", 20) + "needle " + strings.Repeat("filler ", 30)
+
+	tests := []struct {
+		name     string
+		text     string
+		keywords []string
+		snippet  string
+	}{
+		{"marks every keyword", "Lunch at noon, lunch!", []string{"lunch"}, "<mark>Lunch</mark> at noon, <mark>lunch</mark>!"},
+		{"escapes the rest", "Hello <b>world</b>", []string{"world"}, "Hello &lt;b&gt;<mark>world</mark>&lt;/b&gt;"},
+		{"no keyword found", "nothing to see", []string{"else"}, "nothing to see"},
+		{"whole words only", "catalog cat", []string{"cat"}, "catalog <mark>cat</mark>"},
+		{
+			"cuts around the first match",
+			long,
+			[]string{"needle"},
+			"…filler filler filler filler filler <mark>needle</mark> " + strings.Repeat("filler ", 16) + "f…",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if snippet := Highlight(test.text, test.keywords); snippet != test.snippet {
+				t.Errorf("Highlight = %q, expected %q", snippet, test.snippet)
+			}
+		})
+	}
+}
+
+func TestSearchQueryBounds(t *testing.T) {
+	from := time.UnixMilli(1_700_000_000_000)
+	to := from.Add(time.Hour)
+	cursor := NewMessageId(from.Add(time.Minute))
+
+	tests := []struct {
+		name  string
+		query SearchQuery
+		lower string
+		upper string
+	}{
+		{"open", SearchQuery{}, "", ""},
+		{"from", SearchQuery{From: from.UnixMilli()}, "018bcfe56800", ""},
+		{"to is inclusive", SearchQuery{To: to.UnixMilli()}, "", "018bd01c5681"},
+		{"cursor within range", SearchQuery{To: to.UnixMilli(), Before: cursor}, "", cursor},
+		{"cursor past range", SearchQuery{To: from.UnixMilli(), Before: cursor}, "", "018bcfe56801"},
+		{"cursor alone", SearchQuery{Before: cursor}, "", cursor},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lower, upper := test.query.bounds()
+			if lower != test.lower || upper != test.upper {
+				t.Errorf("bounds() = %q, %q, expected %q, %q", lower, upper, test.lower, test.upper)
+			}
+		})
+	}
+}
+
+// searchFixture indexes a small history of two calls, one message a minute
+// starting at base.
+func searchFixture(t *testing.T, base time.Time) (*MemorySearchIndex, []Message) {
+	t.Helper()
+	texts := []struct {
+		callId string
+		userId string
+		text   string
+	}{
+		{"aaaaaa", "ada", "Lunch at noon?"},
+		{"aaaaaa", "bob", "Sure, lunch at the usual place"},
+		{"aaaaaa", "ada", "The deploy is done"},
+		{"bbbbbb", "ada", "Lunch plans in the other call"},
+		{"aaaaaa", "bob", "lunch was great"},
+	}
+
+	index := NewMemorySearchIndex()
+	messages := []Message{}
+	for minute, text := range texts {
+		message := Message{
+			CallId:    text.callId,
+			MessageId: NewMessageId(base.Add(time.Duration(minute) * time.Minute)),
+			UserId:    text.userId,
+			Text:      text.text,
+		}
+		if err := index.Index(context.Background(), message); err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, message)
+	}
+	return index, messages
+}
+
+func resultIds(page SearchPage) []string {
+	ids := []string{}
+	for _, result := range page.Results {
+		ids = append(ids, result.Message.MessageId)
+	}
+	return ids
+}
+
+func TestMemorySearchIndex(t *testing.T) {
+	base := time.UnixMilli(1_700_000_000_000)
+	index, messages := searchFixture(t, base)
+	ids := func(indexes ...int) []string {
+		expected := []string{}
+		for _, i := range indexes {
+			expected = append(expected, messages[i].MessageId)
+		}
+		return expected
+	}
+
+	tests := []struct {
+		name  string
+		query SearchQuery
+		ids   []string
+	}{
+		{"keyword, newest first", SearchQuery{CallIds: []string{"aaaaaa"}, Text: "lunch"}, ids(4, 1, 0)},
+		{"every keyword", SearchQuery{CallIds: []string{"aaaaaa"}, Text: "lunch usual"}, ids(1)},
+		{"case insensitive", SearchQuery{CallIds: []string{"aaaaaa"}, Text: "DEPLOY"}, ids(2)},
+		{"several calls", SearchQuery{CallIds: []string{"aaaaaa", "bbbbbb"}, Text: "lunch"}, ids(4, 3, 1, 0)},
+		{"author", SearchQuery{CallIds: []string{"aaaaaa"}, Author: "ada"}, ids(2, 0)},
+		{"author and keyword", SearchQuery{CallIds: []string{"aaaaaa"}, Author: "bob", Text: "lunch"}, ids(4, 1)},
+		{"from", SearchQuery{CallIds: []string{"aaaaaa"}, Text: "lunch", From: base.Add(time.Minute).UnixMilli()}, ids(4, 1)},
+		{"to", SearchQuery{CallIds: []string{"aaaaaa"}, Text: "lunch", To: base.Add(time.Minute).UnixMilli()}, ids(1, 0)},
+		{"before", SearchQuery{CallIds: []string{"aaaaaa"}, Text: "lunch", Before: messages[4].MessageId}, ids(1, 0)},
+		{"no match", SearchQuery{CallIds: []string{"aaaaaa"}, Text: "dinner"}, ids()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page, err := index.Search(context.Background(), test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := resultIds(page); !slices.Equal(got, test.ids) {
+				t.Errorf("results %q, expected %q", got, test.ids)
+			}
+		})
+	}
+}
+
+func TestMemorySearchIndexPages(t *testing.T) {
+	index, messages := searchFixture(t, time.UnixMilli(1_700_000_000_000))
+	query := SearchQuery{CallIds: []string{"aaaaaa"}, Text: "lunch", Limit: 2}
+
+	first, err := index.Search(context.Background(), query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.HasMore || first.Before != messages[1].MessageId {
+		t.Fatalf("expected more results before %v, got %+v", messages[1].MessageId, first)
+	}
+
+	query.Before = first.Before
+	second, err := index.Search(context.Background(), query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.HasMore || second.Before != "" {
+		t.Fatalf("expected the last page, got %+v", second)
+	}
+	if got := resultIds(second); !slices.Equal(got, []string{messages[0].MessageId}) {
+		t.Fatalf("results %q, expected %q", got, messages[0].MessageId)
+	}
+}
+
+func TestMemorySearchIndexRemoveAndDeleted(t *testing.T) {
+	index, messages := searchFixture(t, time.UnixMilli(1_700_000_000_000))
+
+	index.Remove(context.Background(), messages[4])
+	deleted := messages[1]
+	deleted.Deleted = true
+	index.Index(context.Background(), deleted)
+
+	page, err := index.Search(context.Background(), SearchQuery{CallIds: []string{"aaaaaa"}, Text: "lunch"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resultIds(page); !slices.Equal(got, []string{messages[0].MessageId}) {
+		t.Fatalf("results %q, expected only %q", got, messages[0].MessageId)
+	}
+	if page.Results[0].Snippet != "<mark>Lunch</mark> at noon?" {
+		t.Fatalf("unexpected snippet %q", page.Results[0].Snippet)
+	}
+}
+
+func TestMemorySearchIndexNeedsKeywordsOrAuthor(t *testing.T) {
+	index, _ := searchFixture(t, time.UnixMilli(1_700_000_000_000))
+
+	_, err := index.Search(context.Background(), SearchQuery{CallIds: []string{"aaaaaa"}, Text: "  !! "})
+
+	var clientError *Error
+	if !errors.As(err, &clientError) || clientError.Code != InvalidRequest {
+		t.Fatalf("expected invalid_request, got %v", err)
+	}
+}
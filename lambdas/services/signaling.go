@@ -0,0 +1,66 @@
+package services
+
+// ICECandidate is a single trickled ICE candidate relayed from one participant
+// of a call to the others. An empty Candidate, or EndOfCandidates set, marks the
+// end of the sender's candidate gathering.
+type ICECandidate struct {
+	Candidate       string  `json:"candidate"`
+	SdpMid          *string `json:"sdpMid"`
+	SdpMLineIndex   *uint16 `json:"sdpMLineIndex"`
+	EndOfCandidates bool    `json:"end_of_candidates"`
+}
+
+type ICECandidateEvent struct {
+	ICECandidate
+	CallId string `json:"call_id"`
+	From   string `json:"from"`
+}
+
+// Signal is an offer or answer addressed from one connection of a call to one
+// specific peer, so every pair in a mesh negotiates its own session.
+type Signal struct {
+	CallId                     string `json:"call_id"`
+	From                       string `json:"from"`
+	To                         string `json:"to"`
+	Type                       string `json:"type"`
+	SessionDescriptionProtocol string `json:"sdp"`
+	NegotiationId              int64  `json:"negotiation_id"`
+	UserId                     string `json:"user_id"`
+	DisplayName                string `json:"display_name"`
+}
+
+func IsSignalType(signalType string) bool {
+	return signalType == "offer" || signalType == "answer"
+}
+
+// Peer is a participant of a call as its peers see it. Session descriptions
+// are never part of it: an offer belongs to a single peer connection, so every
+// pair negotiates through signal, the joining participant offering to each of
+// the peers it is given.
+type Peer struct {
+	ConnectionId  string `json:"connection_id"`
+	NegotiationId int64  `json:"negotiation_id"`
+	UserId        string `json:"user_id"`
+	DisplayName   string `json:"display_name"`
+}
+
+func (sdp SDP) Peer() Peer {
+	return Peer{
+		ConnectionId:  sdp.ConnectionId,
+		NegotiationId: sdp.NegotiationId,
+		UserId:        sdp.UserId,
+		DisplayName:   sdp.DisplayName,
+	}
+}
+
+// PeersOf returns every other participant of the call, the connections the
+// given one has to negotiate with.
+func (call Call) PeersOf(connectionId string) []Peer {
+	peers := []Peer{}
+	for _, sdp := range call.ConnectionSdps {
+		if sdp.ConnectionId != connectionId {
+			peers = append(peers, sdp.Peer())
+		}
+	}
+	return peers
+}
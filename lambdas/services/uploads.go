@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	MaxUploadSize     = 25 << 20
+	MaxAttachments    = 10
+	UploadURLExpiry   = 15 * time.Minute
+	DownloadURLExpiry = time.Hour
+)
+
+const (
+	uploadKeyPrefix       = "uploads"
+	maxAttachmentName     = 255
+	defaultAttachmentName = "file"
+)
+
+var AllowedContentTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"video/mp4":       true,
+	"video/webm":      true,
+	"audio/mpeg":      true,
+	"audio/ogg":       true,
+	"application/pdf": true,
+	"application/zip": true,
+	"text/plain":      true,
+}
+
+var unsafeNameCharacters = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// callIdPattern is the call_id of the schemas. Only ids that match are used
+// in object keys, anything else could move the key out of the call's prefix.
+var callIdPattern = regexp.MustCompile(`^[0-9a-f]{1,64}$`)
+
+// Attachment is a file uploaded to the upload bucket and attached to a
+// message. URL is only filled in when the message is read.
+type Attachment struct {
+	Key         string `dynamodbav:"key" json:"key"`
+	Name        string `dynamodbav:"name" json:"name"`
+	ContentType string `dynamodbav:"content_type" json:"content_type"`
+	Size        int64  `dynamodbav:"size" json:"size"`
+	URL         string `dynamodbav:"-" json:"url,omitempty"`
+}
+
+// UploadStore hands out presigned URLs for the upload bucket, so files never
+// pass through the WebSocket API.
+type UploadStore struct {
+	Client *s3.Client
+	Bucket string
+}
+
+// NewUploadStore builds a store for the bucket. Setting S3_ENDPOINT points it
+// at an S3 compatible stand-in, such as a local one in tests.
+func NewUploadStore(cfg aws.Config, bucket string) UploadStore {
+	return UploadStore{
+		Client: s3.NewFromConfig(cfg, func(o *s3.Options) {
+			if endpoint := os.Getenv("S3_ENDPOINT"); endpoint != "" {
+				o.BaseEndpoint = aws.String(endpoint)
+				o.UsePathStyle = true
+			}
+		}),
+		Bucket: bucket,
+	}
+}
+
+func ValidateUpload(contentType string, size int64) error {
+	if !AllowedContentTypes[contentType] {
+		return Errorf(InvalidRequest, "content type %v is not allowed", contentType)
+	}
+	if size <= 0 || size > MaxUploadSize {
+		return Errorf(InvalidRequest, "size must be between 1 and %v bytes", MaxUploadSize)
+	}
+	return nil
+}
+
+// UploadKeyPrefix is where every upload for a call is kept, so attachments
+// can be checked to belong to the call they are sent in.
+func UploadKeyPrefix(callId string) string {
+	return path.Join(uploadKeyPrefix, callId) + "/"
+}
+
+func uploadKey(callId string, name string) string {
+	suffix := make([]byte, 16)
+	if _, err := rand.Read(suffix); err != nil {
+		panic(err)
+	}
+	name = strings.Trim(unsafeNameCharacters.ReplaceAllString(name, "_"), "._")
+	if name == "" {
+		name = defaultAttachmentName
+	}
+	return UploadKeyPrefix(callId) + hex.EncodeToString(suffix) + "/" + name[:min(len(name), maxAttachmentName)]
+}
+
+// PresignUpload generates an object key in the call's prefix and a PUT URL
+// for it that only accepts a body of the declared type and size.
+func (store UploadStore) PresignUpload(ctx context.Context, callId string, name string, contentType string, size int64) (Attachment, string, error) {
+	if !callIdPattern.MatchString(callId) {
+		return Attachment{}, "", Errorf(InvalidRequest, "Invalid call id %q", callId)
+	}
+
+	attachment := Attachment{
+		Key:         uploadKey(callId, name),
+		Name:        name,
+		ContentType: contentType,
+		Size:        size,
+	}
+
+	request, err := s3.NewPresignClient(store.Client).PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(store.Bucket),
+		Key:           aws.String(attachment.Key),
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(size),
+	}, s3.WithPresignExpires(UploadURLExpiry))
+	if err != nil {
+		log.Printf("Could not presign upload, %v", err)
+		return attachment, "", err
+	}
+	return attachment, request.URL, nil
+}
+
+// VerifyAttachment checks an attachment sent with a message was uploaded to
+// the call and takes its type and size from the stored object rather than
+// from the client.
+func (store UploadStore) VerifyAttachment(ctx context.Context, callId string, attachment Attachment) (Attachment, error) {
+	if !callIdPattern.MatchString(callId) {
+		return attachment, Errorf(InvalidRequest, "Invalid call id %q", callId)
+	}
+	if path.Clean(attachment.Key) != attachment.Key || !strings.HasPrefix(attachment.Key, UploadKeyPrefix(callId)) {
+		return attachment, Errorf(InvalidRequest, "attachment %v does not belong to the call %v", attachment.Key, callId)
+	}
+
+	response, err := store.Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(store.Bucket),
+		Key:    aws.String(attachment.Key),
+	})
+	if err != nil {
+		log.Printf("Could not find attachment %v, %v", attachment.Key, err)
+		return attachment, Errorf(InvalidRequest, "attachment %v has not been uploaded", attachment.Key)
+	}
+
+	attachment.ContentType = aws.ToString(response.ContentType)
+	attachment.Size = aws.ToInt64(response.ContentLength)
+	if attachment.Name == "" {
+		attachment.Name = path.Base(attachment.Key)
+	}
+	return attachment, ValidateUpload(attachment.ContentType, attachment.Size)
+}
+
+// WithDownloadURLs fills in short lived download URLs for the attachments of
+// the messages.
+func (store UploadStore) WithDownloadURLs(ctx context.Context, messages []Message) error {
+	presign := s3.NewPresignClient(store.Client)
+	for _, message := range messages {
+		for index, attachment := range message.Attachments {
+			request, err := presign.PresignGetObject(ctx, &s3.GetObjectInput{
+				Bucket:                     aws.String(store.Bucket),
+				Key:                        aws.String(attachment.Key),
+				ResponseContentDisposition: aws.String(fmt.Sprintf("attachment; filename=%q", attachment.Name)),
+			}, s3.WithPresignExpires(DownloadURLExpiry))
+			if err != nil {
+				log.Printf("Could not presign download, %v", err)
+				return err
+			}
+			message.Attachments[index].URL = request.URL
+		}
+	}
+	return nil
+}
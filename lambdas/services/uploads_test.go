@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestUploadKeyStaysInTheCallPrefix(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		suffix   string
+	}{
+		{"plain", "cat.png", "/cat.png"},
+		{"unsafe characters", "my cat (1).png", "/my_cat_1_.png"},
+		{"path", "../../other/cat.png", "/other_cat.png"},
+		{"dots only", "..", "/" + defaultAttachmentName},
+		{"empty", "", "/" + defaultAttachmentName},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key := uploadKey("aaaaaa", test.filename)
+			if !strings.HasPrefix(key, "uploads/aaaaaa/") || !strings.HasSuffix(key, test.suffix) {
+				t.Fatalf("unexpected key %q", key)
+			}
+			if strings.Count(key, "/") != 3 {
+				t.Fatalf("expected the name to be a single segment, got %q", key)
+			}
+		})
+	}
+}
+
+func TestUploadsRejectInvalidCallIds(t *testing.T) {
+	store := UploadStore{Bucket: "uploads"}
+
+	for _, callId := range []string{"", "..", "../bbbbbb", "aaaaaa/..", "aaaaaa/bbbbbb", "AAAAAA", "aaaaaa "} {
+		var clientError *Error
+
+		_, _, err := store.PresignUpload(context.Background(), callId, "cat.png", "image/png", 1)
+		if !errors.As(err, &clientError) || clientError.Code != InvalidRequest {
+			t.Errorf("expected presigning for %q to be rejected, got %v", callId, err)
+		}
+
+		_, err = store.VerifyAttachment(context.Background(), callId, Attachment{Key: "uploads/" + callId + "/0/cat.png"})
+		if !errors.As(err, &clientError) || clientError.Code != InvalidRequest {
+			t.Errorf("expected attachments of %q to be rejected, got %v", callId, err)
+		}
+	}
+}
+
+func TestVerifyAttachmentRejectsKeysOutsideTheCall(t *testing.T) {
+	store := UploadStore{Bucket: "uploads"}
+
+	for _, key := range []string{"uploads/bbbbbb/0/cat.png", "uploads/aaaaaa/../bbbbbb/0/cat.png", "uploads/aaaaaa//cat.png", "cat.png"} {
+		var clientError *Error
+		_, err := store.VerifyAttachment(context.Background(), "aaaaaa", Attachment{Key: key})
+		if !errors.As(err, &clientError) || clientError.Code != InvalidRequest {
+			t.Errorf("expected %q to be rejected, got %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+
+	"dyscord-backend/schemas"
+)
+
+// schemaLocation is where the schemas are registered with the compiler, it
+// only has to give their relative references something to resolve against.
+const schemaLocation = "file:///schemas/"
+
+var missingProperty = regexp.MustCompile(`'([^']*)'`)
+
+// FieldError is what is wrong with one field of a request. Field is a dotted
+// path into the body, with array indexes as their own segments.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// compileSchema compiles the schema of an action, returning nil for actions
+// without one.
+func compileSchema(action string) (*jsonschema.Schema, error) {
+	if _, err := fs.Stat(schemas.FS, action+".json"); err != nil {
+		return nil, nil
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft2020
+	for _, name := range append(schemas.Actions(), strings.TrimSuffix(schemas.Common, ".json")) {
+		data, err := schemas.FS.ReadFile(name + ".json")
+		if err != nil {
+			return nil, err
+		}
+		if err = compiler.AddResource(schemaLocation+name+".json", bytes.NewReader(data)); err != nil {
+			return nil, err
+		}
+	}
+	return compiler.Compile(schemaLocation + action + ".json")
+}
+
+// Validated wraps the handler of an action so bodies that do not match the
+// action's schema are answered with invalid_request, listing every field at
+// fault, before the handler runs.
+func Validated(action string, handler Handler) Handler {
+	schema, err := compileSchema(action)
+	if err != nil {
+		panic(err)
+	}
+	if schema == nil {
+		return handler
+	}
+
+	return func(ctx context.Context, request events.APIGatewayWebsocketProxyRequest) (events.APIGatewayProxyResponse, error) {
+		var body any
+		if err := json.Unmarshal([]byte(request.Body), &body); err != nil {
+			return RespondError(ctx, request, action, ErrInvalidBody)
+		}
+
+		var validationError *jsonschema.ValidationError
+		if err := schema.Validate(body); errors.As(err, &validationError) {
+			return RespondError(ctx, request, action, &Error{
+				Code:    InvalidRequest,
+				Message: "Request does not match the schema of " + action,
+				Fields:  fieldErrors(validationError),
+			})
+		} else if err != nil {
+			return RespondError(ctx, request, action, err)
+		}
+
+		return handler(ctx, request)
+	}
+}
+
+// fieldErrors flattens the tree of schema errors into the errors of single
+// fields, the leaves being the ones that say what is wrong.
+func fieldErrors(validationError *jsonschema.ValidationError) []FieldError {
+	if len(validationError.Causes) > 0 {
+		fields := []FieldError{}
+		for _, cause := range validationError.Causes {
+			fields = append(fields, fieldErrors(cause)...)
+		}
+		return fields
+	}
+
+	field := strings.ReplaceAll(strings.TrimPrefix(validationError.InstanceLocation, "/"), "/", ".")
+	if !strings.HasSuffix(validationError.KeywordLocation, "/required") {
+		return []FieldError{{Field: field, Message: validationError.Message}}
+	}
+
+	fields := []FieldError{}
+	for _, match := range missingProperty.FindAllStringSubmatch(validationError.Message, -1) {
+		name := match[1]
+		if field != "" {
+			name = field + "." + name
+		}
+		fields = append(fields, FieldError{Field: name, Message: "is required"})
+	}
+	return fields
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+
+	"dyscord-backend/schemas"
+)
+
+// validate returns the field errors of a body against the schema of an
+// action, nil when it matches.
+func validate(t *testing.T, action string, body string) []FieldError {
+	t.Helper()
+	schema, err := compileSchema(action)
+	if err != nil || schema == nil {
+		t.Fatalf("could not compile the schema of %v, %v", action, err)
+	}
+
+	var decoded any
+	if err := json.Unmarshal([]byte(body), &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	var validationError *jsonschema.ValidationError
+	err = schema.Validate(decoded)
+	if errors.As(err, &validationError) {
+		return fieldErrors(validationError)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nil
+}
+
+func TestEverySchemaCompiles(t *testing.T) {
+	for _, action := range schemas.Actions() {
+		if schema, err := compileSchema(action); err != nil || schema == nil {
+			t.Errorf("could not compile the schema of %v, %v", action, err)
+		}
+	}
+}
+
+func TestCompileSchemaWithoutSchema(t *testing.T) {
+	schema, err := compileSchema("$default")
+	if schema != nil || err != nil {
+		t.Fatalf("expected no schema, got %v, %v", schema, err)
+	}
+}
+
+func TestFieldErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		action string
+		body   string
+		fields []string
+	}{
+		{"valid", "joinCall", `{"action": "joinCall", "call_id": "aaaaaa"}`, nil},
+		{"valid with optional fields", "sendMessage", `{"action": "sendMessage", "call_id": "aaaaaa", "text": "hi", "request_id": "1", "attachments": [{"key": "uploads/aaaaaa/x"}]}`, nil},
+		{"missing field", "joinCall", `{"action": "joinCall"}`, []string{"call_id"}},
+		{"missing fields", "signal", `{"action": "signal", "call_id": "aaaaaa"}`, []string{"target_connection_id", "type", "sdp"}},
+		{"wrong type", "joinCall", `{"action": "joinCall", "call_id": 7}`, []string{"call_id"}},
+		{"empty string", "joinCall", `{"action": "joinCall", "call_id": ""}`, []string{"call_id"}},
+		{"not an id", "requestUpload", `{"action": "requestUpload", "call_id": "../aaaaaa", "content_type": "image/png", "size": 1}`, []string{"call_id"}},
+		{"not in enum", "signal", `{"action": "signal", "call_id": "aaaaaa", "target_connection_id": "b", "type": "pranswer", "sdp": "v=0"}`, []string{"type"}},
+		{"negative integer", "signal", `{"action": "signal", "call_id": "aaaaaa", "target_connection_id": "b", "type": "offer", "sdp": "v=0", "negotiation_id": -1}`, []string{"negotiation_id"}},
+		{"bad pattern", "getMessages", `{"action": "getMessages", "call_id": "aaaaaa", "before": "nope"}`, []string{"before"}},
+		{"nested in an array", "sendMessage", `{"action": "sendMessage", "call_id": "aaaaaa", "attachments": [{"key": "a"}, {"name": "b"}]}`, []string{"attachments.1.key"}},
+		{"common definitions", "joinCall", `{"action": 1, "call_id": "aaaaaa"}`, []string{"action", "action"}},
+		{"several faults", "signal", `{"action": "signal", "call_id": 1, "target_connection_id": "b", "type": "offer"}`, []string{"call_id", "sdp"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fields := []string{}
+			for _, field := range validate(t, test.action, test.body) {
+				fields = append(fields, field.Field)
+			}
+			if test.fields == nil {
+				test.fields = []string{}
+			}
+			slices.Sort(fields)
+			slices.Sort(test.fields)
+			if !slices.Equal(fields, test.fields) {
+				t.Errorf("fields %q, expected %q", fields, test.fields)
+			}
+		})
+	}
+}
+
+func TestFieldErrorsSayWhatIsRequired(t *testing.T) {
+	fields := validate(t, "joinCall", `{"action": "joinCall"}`)
+	if len(fields) != 1 || fields[0] != (FieldError{Field: "call_id", Message: "is required"}) {
+		t.Fatalf("unexpected field errors %+v", fields)
+	}
+}
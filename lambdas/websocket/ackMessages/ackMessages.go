@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	dyscordconfig "dyscord-backend/config"
+	"dyscord-backend/lambdas/services"
+)
+
+type Request struct {
+	CallId    string `json:"call_id"`
+	MessageId string `json:"message_id"`
+}
+
+var (
+	db          services.CallDatabase
+	messages    services.MessageDatabase
+	receipts    services.ReceiptDatabase
+	connections services.ConnectionDatabase
+	api         services.APIGatewayManagementClient
+)
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		fmt.Println("Error loading config")
+	}
+	client := dynamodb.NewFromConfig(cfg)
+	db = services.CallDatabase{
+		Client:    client,
+		TableName: dyscordconfig.TABLENAME,
+	}
+	messages = services.MessageDatabase{
+		Client:    client,
+		TableName: dyscordconfig.MESSAGES_TABLENAME,
+	}
+	receipts = services.ReceiptDatabase{
+		Client:    client,
+		TableName: dyscordconfig.RECEIPTS_TABLENAME,
+	}
+	connections = services.ConnectionDatabase{
+		Client:    client,
+		TableName: dyscordconfig.CONNECTIONS_TABLENAME,
+	}
+	api = services.NewAPIGatewayManagementClient(cfg, client)
+}
+
+func handler(ctx context.Context, request events.APIGatewayWebsocketProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var requestBody Request
+
+	if err := json.Unmarshal([]byte(request.Body), &requestBody); err != nil {
+		return services.RespondError(ctx, request, "ackMessages", services.ErrInvalidBody)
+	}
+
+	connectionId, err := services.CallerConnectionId(request)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "ackMessages", err)
+	}
+
+	userId, _ := services.CallerUser(request)
+	principal := services.Principal(connectionId, userId)
+
+	call, err := db.GetCall(ctx, requestBody.CallId)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "ackMessages", err)
+	}
+
+	if !call.HasConnection(connectionId) {
+		return services.RespondError(ctx, request, "ackMessages", services.NotInCall(call, connectionId))
+	}
+
+	if _, err = messages.GetMessage(ctx, requestBody.CallId, requestBody.MessageId); err != nil {
+		return services.RespondError(ctx, request, "ackMessages", err)
+	}
+
+	moved, err := receipts.Advance(ctx, services.ReadMarker{
+		Principal:         principal,
+		CallId:            requestBody.CallId,
+		LastReadMessageId: requestBody.MessageId,
+		UpdatedAt:         time.Now().UnixMilli(),
+		TTL:               call.TTL,
+	})
+
+	if err != nil {
+		return services.RespondError(ctx, request, "ackMessages", err)
+	}
+
+	marker, err := receipts.GetMarker(ctx, principal, requestBody.CallId)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "ackMessages", err)
+	}
+
+	marker.UnreadCount, err = messages.CountUnread(ctx, requestBody.CallId, marker.LastReadMessageId, principal)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "ackMessages", err)
+	}
+
+	// keep the badges on the user's other devices in step
+	if moved && userId != "" {
+		others, err := connections.GetUserConnections(ctx, userId)
+		if err != nil {
+			log.Printf("Could not find other connections of %v, %v", userId, err)
+		}
+
+		connectionIds := []string{}
+		for _, other := range others {
+			if other.ConnectionId != connectionId {
+				connectionIds = append(connectionIds, other.ConnectionId)
+			}
+		}
+
+		api.PostToConnections(ctx, connectionIds, services.NewEnvelope("readMarkerUpdated", marker))
+	}
+
+	return services.Respond(ctx, request, "ackMessages", marker)
+}
+
+func main() {
+	lambda.Start(services.Validated("ackMessages", handler))
+}
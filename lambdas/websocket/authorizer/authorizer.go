@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+
+	"dyscord-backend/lambdas/services"
+)
+
+var (
+	validator *services.TokenValidator
+)
+
+func init() {
+	validator = &services.TokenValidator{
+		Secret:       []byte(os.Getenv("JWT_SECRET")),
+		JWKSLocation: os.Getenv("JWKS_URL"),
+	}
+}
+
+// token reads the bearer token from the query string, since browsers cannot
+// set headers on a WebSocket handshake. It is the identity source of the
+// authorizer, so API Gateway rejects connections without one before they get
+// here.
+func token(request events.APIGatewayCustomAuthorizerRequestTypeRequest) string {
+	return request.QueryStringParameters["token"]
+}
+
+func handler(ctx context.Context, request events.APIGatewayCustomAuthorizerRequestTypeRequest) (events.APIGatewayCustomAuthorizerResponse, error) {
+	claims, err := validator.Validate(ctx, token(request))
+
+	if err != nil {
+		log.Printf("Rejected connection, %v", err)
+		return events.APIGatewayCustomAuthorizerResponse{}, errors.New("Unauthorized")
+	}
+
+	// the codec is settled here so a connection asking for one we do not
+	// speak is never opened
+	codec, err := services.ParseCodec(request.QueryStringParameters["protocol"])
+
+	if err != nil {
+		log.Printf("Rejected connection, %v", err)
+		return events.APIGatewayCustomAuthorizerResponse{}, errors.New("Unauthorized")
+	}
+
+	return events.APIGatewayCustomAuthorizerResponse{
+		PrincipalID: claims.Subject,
+		PolicyDocument: events.APIGatewayCustomAuthorizerPolicy{
+			Version: "2012-10-17",
+			Statement: []events.IAMPolicyStatement{
+				{
+					Action:   []string{"execute-api:Invoke"},
+					Effect:   "Allow",
+					Resource: []string{request.MethodArn},
+				},
+			},
+		},
+		Context: map[string]any{
+			"user_id":      claims.Subject,
+			"display_name": claims.Name,
+			"codec":        string(codec),
+		},
+	}, nil
+}
+
+func main() {
+	lambda.Start(handler)
+}
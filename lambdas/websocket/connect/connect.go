@@ -1,38 +1,57 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	dyscordconfig "dyscord-backend/config"
+	"dyscord-backend/lambdas/services"
+)
+
+var (
+	connections services.ConnectionDatabase
 )
 
-type APIGatewayProxyRequest struct {
-	events.APIGatewayProxyRequest
-	ConnectionId string `json:"connectionId"`
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		fmt.Println("Error loading config")
+	}
+	connections = services.ConnectionDatabase{
+		Client:    dynamodb.NewFromConfig(cfg),
+		TableName: dyscordconfig.CONNECTIONS_TABLENAME,
+	}
 }
 
-func handler(request APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+func handler(ctx context.Context, request events.APIGatewayWebsocketProxyRequest) (events.APIGatewayProxyResponse, error) {
 
 	fmt.Printf("%v", request)
 
-	responseBody, err := json.Marshal(map[string]string{
-		"message":      "Connected!",
-		"connectionId": request.ConnectionId,
+	connectionId := request.RequestContext.ConnectionID
+	userId, displayName := services.CallerUser(request)
+
+	err := connections.CreateConnection(ctx, services.Connection{
+		ConnectionId: connectionId,
+		UserId:       userId,
+		DisplayName:  displayName,
+		Codec:        services.CallerCodec(request),
+		ConnectedAt:  time.Now().Unix(),
+		TTL:          time.Now().Add(time.Hour * 24).Unix(),
 	})
 
 	if err != nil {
-		return events.APIGatewayProxyResponse{StatusCode: 500, Body: err.Error()}, nil
+		return services.RespondError(ctx, request, "connect", err)
 	}
 
-	return events.APIGatewayProxyResponse{
-		StatusCode: 200,
-		Headers: map[string]string{
-			"Content-Type": "application/json",
-		},
-		Body: string(responseBody),
-	}, nil
+	return services.Respond(ctx, request, "connect", map[string]string{
+		"connection_id": connectionId,
+	})
 }
 
 func main() {
@@ -4,7 +4,6 @@ import (
 	"context"
 	"crypto/sha1"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"log"
 	"time"
@@ -33,7 +32,15 @@ func init() {
 	}
 }
 
-func handler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+func handler(ctx context.Context, request events.APIGatewayWebsocketProxyRequest) (events.APIGatewayProxyResponse, error) {
+	connectionId, err := services.CallerConnectionId(request)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "createCall", err)
+	}
+
+	userId, _ := services.CallerUser(request)
+
 	hasher := sha1.New()
 	hasher.Write([]byte(time.Now().GoString()))
 	sha1_hash := hex.EncodeToString(hasher.Sum(nil))[:6]
@@ -49,36 +56,23 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (events
 	}
 
 	log.Println("Created hash: ", sha1_hash)
-	err := db.CreateCall(ctx, services.Call{
+	err = db.CreateCall(ctx, services.Call{
 		CallId:         sha1_hash,
 		ConnectionSdps: []services.SDP{},
+		Moderators:     []string{services.Principal(connectionId, userId)},
+		CreatedBy:      connectionId,
 		TTL:            time.Now().Add(time.Hour * 24).Unix(),
 	})
 
 	if err != nil {
-		return events.APIGatewayProxyResponse{StatusCode: 500, Body: err.Error()}, nil
+		return services.RespondError(ctx, request, "createCall", err)
 	}
 
-	responseBody, err := json.Marshal(map[string]any{
-		"action": "createCall",
-		"data": map[string]string{
-			"call_id": sha1_hash,
-		},
+	return services.Respond(ctx, request, "createCall", map[string]string{
+		"call_id": sha1_hash,
 	})
-
-	if err != nil {
-		return events.APIGatewayProxyResponse{StatusCode: 500, Body: err.Error()}, nil
-	}
-
-	return events.APIGatewayProxyResponse{
-		StatusCode: 200,
-		Headers: map[string]string{
-			"Content-Type": "application/json",
-		},
-		Body: string(responseBody),
-	}, nil
 }
 
 func main() {
-	lambda.Start(handler)
+	lambda.Start(services.Validated("createCall", handler))
 }
@@ -1,29 +1,21 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-)
-
-func handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 
-	responseBody, err := json.Marshal(map[string]string{
-		"message": "Default!",
-	})
+	"dyscord-backend/lambdas/services"
+)
 
-	if err != nil {
-		return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Sever Error"}, nil
-	}
+// router gets every request API Gateway has no route for. Registering a
+// handler on it with router.Handle serves that action from this Lambda
+// instead of a Lambda of its own.
+var router = services.NewRouter()
 
-	return events.APIGatewayProxyResponse{
-		StatusCode: 200,
-		Headers: map[string]string{
-			"Content-Type": "application/json",
-		},
-		Body: string(responseBody),
-	}, nil
+func handler(ctx context.Context, request events.APIGatewayWebsocketProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return router.Route(ctx, request)
 }
 
 func main() {
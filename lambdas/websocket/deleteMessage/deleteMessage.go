@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	dyscordconfig "dyscord-backend/config"
+	"dyscord-backend/lambdas/services"
+)
+
+type Request struct {
+	CallId    string `json:"call_id"`
+	MessageId string `json:"message_id"`
+}
+
+var (
+	db       services.CallDatabase
+	messages services.MessageDatabase
+	search   services.SearchIndex
+	api      services.APIGatewayManagementClient
+)
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		fmt.Println("Error loading config")
+	}
+	client := dynamodb.NewFromConfig(cfg)
+	db = services.CallDatabase{
+		Client:    client,
+		TableName: dyscordconfig.TABLENAME,
+	}
+	messages = services.MessageDatabase{
+		Client:    client,
+		TableName: dyscordconfig.MESSAGES_TABLENAME,
+	}
+	search = services.DynamoSearchIndex{
+		Client:    client,
+		TableName: dyscordconfig.SEARCH_TABLENAME,
+		Messages:  messages,
+	}
+	api = services.NewAPIGatewayManagementClient(cfg, client)
+}
+
+func handler(ctx context.Context, request events.APIGatewayWebsocketProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var requestBody Request
+
+	if err := json.Unmarshal([]byte(request.Body), &requestBody); err != nil {
+		return services.RespondError(ctx, request, "deleteMessage", services.ErrInvalidBody)
+	}
+
+	connectionId, err := services.CallerConnectionId(request)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "deleteMessage", err)
+	}
+
+	userId, _ := services.CallerUser(request)
+
+	call, err := db.GetCall(ctx, requestBody.CallId)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "deleteMessage", err)
+	}
+
+	if !call.HasConnection(connectionId) {
+		return services.RespondError(ctx, request, "deleteMessage", services.NotInCall(call, connectionId))
+	}
+
+	message, err := messages.GetMessage(ctx, requestBody.CallId, requestBody.MessageId)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "deleteMessage", err)
+	}
+
+	if !message.IsAuthor(connectionId, userId) && !call.IsModerator(services.Principal(connectionId, userId)) {
+		return services.RespondError(ctx, request, "deleteMessage", services.Errorf(services.Forbidden, "Connection %v cannot delete message %v", connectionId, requestBody.MessageId))
+	}
+
+	previous := message
+	message, err = messages.DeleteMessage(ctx, message, time.Now())
+
+	if err != nil {
+		return services.RespondError(ctx, request, "deleteMessage", err)
+	}
+
+	search.Remove(ctx, previous)
+
+	api.PostToConnections(ctx, call.ConnectionIds(connectionId), services.NewEnvelope("messageDeleted", message))
+
+	return services.Respond(ctx, request, "deleteMessage", message)
+}
+
+func main() {
+	lambda.Start(services.Validated("deleteMessage", handler))
+}
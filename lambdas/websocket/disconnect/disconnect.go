@@ -1,29 +1,51 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"fmt"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-)
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 
-func handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	dyscordconfig "dyscord-backend/config"
+	"dyscord-backend/lambdas/services"
+)
 
-	responseBody, err := json.Marshal(map[string]string{
-		"message": "Disconnected!",
-	})
+var (
+	db          services.CallDatabase
+	connections services.ConnectionDatabase
+	api         services.APIGatewayManagementClient
+)
 
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
 	if err != nil {
-		return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Sever Error"}, nil
+		fmt.Println("Error loading config")
+	}
+	client := dynamodb.NewFromConfig(cfg)
+	db = services.CallDatabase{
+		Client:    client,
+		TableName: dyscordconfig.TABLENAME,
+	}
+	connections = services.ConnectionDatabase{
+		Client:    client,
+		TableName: dyscordconfig.CONNECTIONS_TABLENAME,
+	}
+	api = services.NewAPIGatewayManagementClient(cfg, client)
+}
+
+// handler removes the connection from every call it joined, the update
+// handler lets the remaining participants know it is gone.
+func handler(ctx context.Context, request events.APIGatewayWebsocketProxyRequest) (events.APIGatewayProxyResponse, error) {
+	connectionId := request.RequestContext.ConnectionID
+
+	if err := api.Evict(ctx, connectionId); err != nil {
+		return services.RespondError(ctx, request, "disconnect", err)
 	}
 
-	return events.APIGatewayProxyResponse{
-		StatusCode: 200,
-		Headers: map[string]string{
-			"Content-Type": "application/json",
-		},
-		Body: string(responseBody),
-	}, nil
+	return services.Respond(ctx, request, "disconnect", nil)
 }
 
 func main() {
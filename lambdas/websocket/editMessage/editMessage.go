@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	dyscordconfig "dyscord-backend/config"
+	"dyscord-backend/lambdas/services"
+)
+
+type Request struct {
+	CallId    string `json:"call_id"`
+	MessageId string `json:"message_id"`
+	Text      string `json:"text"`
+}
+
+var (
+	db       services.CallDatabase
+	messages services.MessageDatabase
+	search   services.SearchIndex
+	api      services.APIGatewayManagementClient
+)
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		fmt.Println("Error loading config")
+	}
+	client := dynamodb.NewFromConfig(cfg)
+	db = services.CallDatabase{
+		Client:    client,
+		TableName: dyscordconfig.TABLENAME,
+	}
+	messages = services.MessageDatabase{
+		Client:    client,
+		TableName: dyscordconfig.MESSAGES_TABLENAME,
+	}
+	search = services.DynamoSearchIndex{
+		Client:    client,
+		TableName: dyscordconfig.SEARCH_TABLENAME,
+		Messages:  messages,
+	}
+	api = services.NewAPIGatewayManagementClient(cfg, client)
+}
+
+func handler(ctx context.Context, request events.APIGatewayWebsocketProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var requestBody Request
+
+	if err := json.Unmarshal([]byte(request.Body), &requestBody); err != nil {
+		return services.RespondError(ctx, request, "editMessage", services.ErrInvalidBody)
+	}
+
+	if strings.TrimSpace(requestBody.Text) == "" || len(requestBody.Text) > services.MaxMessageLength {
+		return services.RespondError(ctx, request, "editMessage", services.Errorf(services.InvalidRequest, "Message text must be between 1 and %v characters", services.MaxMessageLength))
+	}
+
+	connectionId, err := services.CallerConnectionId(request)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "editMessage", err)
+	}
+
+	userId, _ := services.CallerUser(request)
+
+	call, err := db.GetCall(ctx, requestBody.CallId)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "editMessage", err)
+	}
+
+	if !call.HasConnection(connectionId) {
+		return services.RespondError(ctx, request, "editMessage", services.NotInCall(call, connectionId))
+	}
+
+	message, err := messages.GetMessage(ctx, requestBody.CallId, requestBody.MessageId)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "editMessage", err)
+	}
+
+	if !message.IsAuthor(connectionId, userId) && !call.IsModerator(services.Principal(connectionId, userId)) {
+		return services.RespondError(ctx, request, "editMessage", services.Errorf(services.Forbidden, "Connection %v cannot edit message %v", connectionId, requestBody.MessageId))
+	}
+
+	previous := message
+	message, err = messages.EditMessage(ctx, message, requestBody.Text, time.Now())
+
+	if err != nil {
+		return services.RespondError(ctx, request, "editMessage", err)
+	}
+
+	search.Remove(ctx, previous)
+	search.Index(ctx, message)
+
+	api.PostToConnections(ctx, call.ConnectionIds(connectionId), services.NewEnvelope("messageEdited", message))
+
+	return services.Respond(ctx, request, "editMessage", message)
+}
+
+func main() {
+	lambda.Start(services.Validated("editMessage", handler))
+}
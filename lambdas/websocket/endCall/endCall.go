@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	dyscordconfig "dyscord-backend/config"
+	"dyscord-backend/lambdas/services"
+)
+
+type Request struct {
+	CallId string `json:"call_id"`
+}
+
+var (
+	db services.CallDatabase
+)
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		fmt.Println("Error loading config")
+	}
+	db = services.CallDatabase{
+		Client:    dynamodb.NewFromConfig(cfg),
+		TableName: dyscordconfig.TABLENAME,
+	}
+}
+
+// handler ends a call for everyone in it, only moderators of the call may do
+// so. The update stream then tells whoever is still connected.
+func handler(ctx context.Context, request events.APIGatewayWebsocketProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var requestBody Request
+
+	if err := json.Unmarshal([]byte(request.Body), &requestBody); err != nil {
+		return services.RespondError(ctx, request, "endCall", services.ErrInvalidBody)
+	}
+
+	connectionId, err := services.CallerConnectionId(request)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "endCall", err)
+	}
+
+	userId, _ := services.CallerUser(request)
+	principal := services.Principal(connectionId, userId)
+
+	call, err := db.GetCall(ctx, requestBody.CallId)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "endCall", err)
+	}
+
+	if !call.Exists() {
+		return services.RespondError(ctx, request, "endCall", services.Errorf(services.CallNotFound, "Call %v does not exist", requestBody.CallId))
+	}
+
+	if !call.IsModerator(principal) {
+		return services.RespondError(ctx, request, "endCall", services.Errorf(services.Forbidden, "Only moderators can end the call %v", requestBody.CallId))
+	}
+
+	if err = db.EndCall(ctx, call, principal); err != nil {
+		return services.RespondError(ctx, request, "endCall", err)
+	}
+
+	return services.Respond(ctx, request, "endCall", map[string]string{
+		"call_id": requestBody.CallId,
+	})
+}
+
+func main() {
+	lambda.Start(services.Validated("endCall", handler))
+}
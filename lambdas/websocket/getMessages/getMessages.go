@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	dyscordconfig "dyscord-backend/config"
+	"dyscord-backend/lambdas/services"
+)
+
+type Request struct {
+	CallId string `json:"call_id"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+	Limit  int    `json:"limit"`
+}
+
+var (
+	db       services.CallDatabase
+	messages services.MessageDatabase
+	uploads  services.UploadStore
+)
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		fmt.Println("Error loading config")
+	}
+	client := dynamodb.NewFromConfig(cfg)
+	db = services.CallDatabase{
+		Client:    client,
+		TableName: dyscordconfig.TABLENAME,
+	}
+	messages = services.MessageDatabase{
+		Client:    client,
+		TableName: dyscordconfig.MESSAGES_TABLENAME,
+	}
+	uploads = services.NewUploadStore(cfg, os.Getenv("UPLOAD_BUCKET"))
+}
+
+func handler(ctx context.Context, request events.APIGatewayWebsocketProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var requestBody Request
+
+	if err := json.Unmarshal([]byte(request.Body), &requestBody); err != nil {
+		return services.RespondError(ctx, request, "getMessages", services.ErrInvalidBody)
+	}
+
+	connectionId, err := services.CallerConnectionId(request)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "getMessages", err)
+	}
+
+	userId, _ := services.CallerUser(request)
+
+	call, err := db.GetCall(ctx, requestBody.CallId)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "getMessages", err)
+	}
+
+	if !call.HasConnection(connectionId) {
+		return services.RespondError(ctx, request, "getMessages", services.NotInCall(call, connectionId))
+	}
+
+	page, err := messages.GetMessages(ctx, requestBody.CallId, requestBody.Before, requestBody.After, requestBody.Limit)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "getMessages", err)
+	}
+
+	if err = uploads.WithDownloadURLs(ctx, page.Messages); err != nil {
+		return services.RespondError(ctx, request, "getMessages", err)
+	}
+
+	return services.Respond(ctx, request, "getMessages", page.ForPrincipal(services.Principal(connectionId, userId)))
+}
+
+func main() {
+	lambda.Start(services.Validated("getMessages", handler))
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	dyscordconfig "dyscord-backend/config"
+	"dyscord-backend/lambdas/services"
+)
+
+// Request may name calls the caller has joined but not read anything in yet,
+// whose whole history then counts as unread. Calls the caller never read in
+// nor joined are skipped.
+type Request struct {
+	CallIds []string `json:"call_ids"`
+}
+
+var (
+	messages    services.MessageDatabase
+	receipts    services.ReceiptDatabase
+	connections services.ConnectionDatabase
+)
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		fmt.Println("Error loading config")
+	}
+	client := dynamodb.NewFromConfig(cfg)
+	messages = services.MessageDatabase{
+		Client:    client,
+		TableName: dyscordconfig.MESSAGES_TABLENAME,
+	}
+	receipts = services.ReceiptDatabase{
+		Client:    client,
+		TableName: dyscordconfig.RECEIPTS_TABLENAME,
+	}
+	connections = services.ConnectionDatabase{
+		Client:    client,
+		TableName: dyscordconfig.CONNECTIONS_TABLENAME,
+	}
+}
+
+// handler is called by clients when they reconnect to get their badges right
+// before any new messages arrive.
+func handler(ctx context.Context, request events.APIGatewayWebsocketProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var requestBody Request
+
+	if request.Body != "" {
+		if err := json.Unmarshal([]byte(request.Body), &requestBody); err != nil {
+			return services.RespondError(ctx, request, "getUnreadCounts", services.ErrInvalidBody)
+		}
+	}
+
+	connectionId, err := services.CallerConnectionId(request)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "getUnreadCounts", err)
+	}
+
+	userId, _ := services.CallerUser(request)
+	principal := services.Principal(connectionId, userId)
+
+	markers, err := receipts.GetMarkers(ctx, principal)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "getUnreadCounts", err)
+	}
+
+	connection, err := connections.GetConnection(ctx, connectionId)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "getUnreadCounts", err)
+	}
+
+	for _, callId := range requestBody.CallIds {
+		if !slices.Contains(connection.CallIds, callId) {
+			continue
+		}
+		if !slices.ContainsFunc(markers, func(marker services.ReadMarker) bool { return marker.CallId == callId }) {
+			markers = append(markers, services.ReadMarker{Principal: principal, CallId: callId})
+		}
+	}
+
+	for index, marker := range markers {
+		markers[index].UnreadCount, err = messages.CountUnread(ctx, marker.CallId, marker.LastReadMessageId, principal)
+
+		if err != nil {
+			return services.RespondError(ctx, request, "getUnreadCounts", err)
+		}
+	}
+
+	return services.Respond(ctx, request, "getUnreadCounts", markers)
+}
+
+func main() {
+	lambda.Start(services.Validated("getUnreadCounts", handler))
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	dyscordconfig "dyscord-backend/config"
+	"dyscord-backend/lambdas/services"
+)
+
+type Request struct {
+	services.ICECandidate
+	CallId             string `json:"call_id"`
+	TargetConnectionId string `json:"target_connection_id"`
+}
+
+var (
+	db  services.CallDatabase
+	api services.APIGatewayManagementClient
+)
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		fmt.Println("Error loading config")
+	}
+	client := dynamodb.NewFromConfig(cfg)
+	db = services.CallDatabase{
+		Client:    client,
+		TableName: dyscordconfig.TABLENAME,
+	}
+	api = services.NewAPIGatewayManagementClient(cfg, client)
+}
+
+func handler(ctx context.Context, request events.APIGatewayWebsocketProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var requestBody Request
+
+	if err := json.Unmarshal([]byte(request.Body), &requestBody); err != nil {
+		return services.RespondError(ctx, request, "iceCandidate", services.ErrInvalidBody)
+	}
+
+	connectionId, err := services.CallerConnectionId(request)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "iceCandidate", err)
+	}
+
+	call, err := db.GetCall(ctx, requestBody.CallId)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "iceCandidate", err)
+	}
+
+	if !call.HasConnection(connectionId) {
+		return services.RespondError(ctx, request, "iceCandidate", services.NotInCall(call, connectionId))
+	}
+
+	// an empty candidate is how WebRTC signals the end of gathering
+	if requestBody.Candidate == "" {
+		requestBody.EndOfCandidates = true
+	}
+
+	connectionIds := call.ConnectionIds(connectionId)
+	if requestBody.TargetConnectionId != "" {
+		if requestBody.TargetConnectionId == connectionId || !call.HasConnection(requestBody.TargetConnectionId) {
+			return services.RespondError(ctx, request, "iceCandidate", services.Errorf(services.NotParticipant, "Connection %v is not a peer in the call %v", requestBody.TargetConnectionId, requestBody.CallId))
+		}
+		connectionIds = []string{requestBody.TargetConnectionId}
+	}
+
+	api.PostToConnections(ctx, connectionIds, services.NewEnvelope("iceCandidate", services.ICECandidateEvent{
+		ICECandidate: requestBody.ICECandidate,
+		CallId:       requestBody.CallId,
+		From:         connectionId,
+	}))
+
+	return services.Respond(ctx, request, "iceCandidate", map[string]any{
+		"call_id": requestBody.CallId,
+		"relayed": len(connectionIds),
+	})
+}
+
+func main() {
+	lambda.Start(services.Validated("iceCandidate", handler))
+}
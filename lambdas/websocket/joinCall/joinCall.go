@@ -15,12 +15,12 @@ import (
 )
 
 type Request struct {
-	services.SDP
 	CallId string `dynamodbav:"call_id" json:"call_id"`
 }
 
 var (
-	db services.CallDatabase
+	db          services.CallDatabase
+	connections services.ConnectionDatabase
 )
 
 func init() {
@@ -28,62 +28,66 @@ func init() {
 	if err != nil {
 		fmt.Println("Error loading config")
 	}
+	client := dynamodb.NewFromConfig(cfg)
 	db = services.CallDatabase{
-		Client:    dynamodb.NewFromConfig(cfg),
+		Client:    client,
 		TableName: dyscordconfig.TABLENAME,
 	}
+	connections = services.ConnectionDatabase{
+		Client:    client,
+		TableName: dyscordconfig.CONNECTIONS_TABLENAME,
+	}
 }
 
-func handler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+func handler(ctx context.Context, request events.APIGatewayWebsocketProxyRequest) (events.APIGatewayProxyResponse, error) {
 	var requestBody Request
 
-	fmt.Printf("%v\n", request)
-	fmt.Printf("%v\n", request.Body)
-
 	if err := json.Unmarshal([]byte(request.Body), &requestBody); err != nil {
-		return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Could not parse body"}, nil
+		return services.RespondError(ctx, request, "joinCall", services.ErrInvalidBody)
 	}
 
-	fmt.Printf("%v\n", requestBody)
+	connectionId, err := services.CallerConnectionId(request)
 
-	response, err := db.GetCall(ctx, requestBody.CallId)
+	if err != nil {
+		return services.RespondError(ctx, request, "joinCall", err)
+	}
 
-	fmt.Printf("%v\n", response)
+	userId, displayName := services.CallerUser(request)
+
+	response, err := db.GetCall(ctx, requestBody.CallId)
 
 	if err != nil {
-		return events.APIGatewayProxyResponse{StatusCode: 500, Body: err.Error()}, nil
+		return services.RespondError(ctx, request, "joinCall", err)
 	}
 
 	for _, sdp := range response.ConnectionSdps {
-		if requestBody.ConnectionId == sdp.ConnectionId {
-			return events.APIGatewayProxyResponse{StatusCode: 500, Body: fmt.Sprintf("Connection %v already joined the call %v", sdp.ConnectionId, requestBody.CallId)}, nil
+		if connectionId == sdp.ConnectionId {
+			return services.RespondError(ctx, request, "joinCall", services.Errorf(services.AlreadyJoined, "Connection %v already joined the call %v", sdp.ConnectionId, requestBody.CallId))
 		}
 	}
 
-	_, err = db.JoinCall(ctx, response, requestBody.ConnectionId, requestBody.SDP)
+	_, err = db.JoinCall(ctx, response, connectionId, services.SDP{
+		ConnectionId: connectionId,
+		UserId:       userId,
+		DisplayName:  displayName,
+	})
 
 	if err != nil {
-		return events.APIGatewayProxyResponse{StatusCode: 500, Body: err.Error()}, nil
+		return services.RespondError(ctx, request, "joinCall", err)
 	}
 
-	responseBody, err := json.Marshal(map[string]string{
-		"action": "joinCall",
-		"data":   fmt.Sprintf("Joined Call %v", requestBody.ConnectionId),
-	})
+	err = connections.AddCall(ctx, connectionId, requestBody.CallId)
 
 	if err != nil {
-		return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Sever Error"}, nil
+		return services.RespondError(ctx, request, "joinCall", err)
 	}
 
-	return events.APIGatewayProxyResponse{
-		StatusCode: 200,
-		Headers: map[string]string{
-			"Content-Type": "application/json",
-		},
-		Body: string(responseBody),
-	}, nil
+	return services.Respond(ctx, request, "joinCall", map[string]string{
+		"call_id":       requestBody.CallId,
+		"connection_id": connectionId,
+	})
 }
 
 func main() {
-	lambda.Start(handler)
+	lambda.Start(services.Validated("joinCall", handler))
 }
@@ -14,12 +14,12 @@ import (
 )
 
 type Request struct {
-	CallId       string `dynamodbav:"call_id" json:"call_id"`
-	ConnectionId string `dynamodbav:"connection_id" json:"connection_id"`
+	CallId string `dynamodbav:"call_id" json:"call_id"`
 }
 
 var (
-	db services.CallDatabase
+	db          services.CallDatabase
+	connections services.ConnectionDatabase
 )
 
 func init() {
@@ -27,49 +27,57 @@ func init() {
 	if err != nil {
 		fmt.Println("Error loading config")
 	}
+	client := dynamodb.NewFromConfig(cfg)
 	db = services.CallDatabase{
-		Client:    dynamodb.NewFromConfig(cfg),
+		Client:    client,
 		TableName: dyscordconfig.TABLENAME,
 	}
+	connections = services.ConnectionDatabase{
+		Client:    client,
+		TableName: dyscordconfig.CONNECTIONS_TABLENAME,
+	}
 }
 
-func handler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+func handler(ctx context.Context, request events.APIGatewayWebsocketProxyRequest) (events.APIGatewayProxyResponse, error) {
 	var requestBody Request
 
 	if err := json.Unmarshal([]byte(request.Body), &requestBody); err != nil {
-		return events.APIGatewayProxyResponse{StatusCode: 500, Body: err.Error()}, nil
+		return services.RespondError(ctx, request, "leaveCall", services.ErrInvalidBody)
+	}
+
+	connectionId, err := services.CallerConnectionId(request)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "leaveCall", err)
 	}
 
 	call, err := db.GetCall(ctx, requestBody.CallId)
 
 	if err != nil {
-		return events.APIGatewayProxyResponse{StatusCode: 500, Body: err.Error()}, nil
+		return services.RespondError(ctx, request, "leaveCall", err)
 	}
 
-	_, err = db.LeaveCall(ctx, call, requestBody.ConnectionId)
+	if !call.HasConnection(connectionId) {
+		return services.RespondError(ctx, request, "leaveCall", services.NotInCall(call, connectionId))
+	}
+
+	_, err = db.LeaveCall(ctx, call, connectionId)
 
 	if err != nil {
-		return events.APIGatewayProxyResponse{StatusCode: 500, Body: err.Error()}, nil
+		return services.RespondError(ctx, request, "leaveCall", err)
 	}
 
-	responseBody, err := json.Marshal(map[string]string{
-		"action": "leaveCall",
-		"data":   "Successfully Left Call",
-	})
+	err = connections.RemoveCall(ctx, connectionId, requestBody.CallId)
 
 	if err != nil {
-		return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Sever Error"}, nil
+		return services.RespondError(ctx, request, "leaveCall", err)
 	}
 
-	return events.APIGatewayProxyResponse{
-		StatusCode: 200,
-		Headers: map[string]string{
-			"Content-Type": "application/json",
-		},
-		Body: string(responseBody),
-	}, nil
+	return services.Respond(ctx, request, "leaveCall", map[string]string{
+		"call_id": requestBody.CallId,
+	})
 }
 
 func main() {
-	lambda.Start(handler)
+	lambda.Start(services.Validated("leaveCall", handler))
 }
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	dyscordconfig "dyscord-backend/config"
+	"dyscord-backend/lambdas/services"
+)
+
+type Request struct {
+	CallId    string `json:"call_id"`
+	MessageId string `json:"message_id"`
+	Emoji     string `json:"emoji"`
+}
+
+var (
+	db       services.CallDatabase
+	messages services.MessageDatabase
+	api      services.APIGatewayManagementClient
+)
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		fmt.Println("Error loading config")
+	}
+	client := dynamodb.NewFromConfig(cfg)
+	db = services.CallDatabase{
+		Client:    client,
+		TableName: dyscordconfig.TABLENAME,
+	}
+	messages = services.MessageDatabase{
+		Client:    client,
+		TableName: dyscordconfig.MESSAGES_TABLENAME,
+	}
+	api = services.NewAPIGatewayManagementClient(cfg, client)
+}
+
+func handler(ctx context.Context, request events.APIGatewayWebsocketProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var requestBody Request
+
+	if err := json.Unmarshal([]byte(request.Body), &requestBody); err != nil {
+		return services.RespondError(ctx, request, "removeReaction", services.ErrInvalidBody)
+	}
+
+	if !services.ValidEmoji(requestBody.Emoji) {
+		return services.RespondError(ctx, request, "removeReaction", services.Errorf(services.InvalidRequest, "Invalid emoji %q", requestBody.Emoji))
+	}
+
+	connectionId, err := services.CallerConnectionId(request)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "removeReaction", err)
+	}
+
+	userId, _ := services.CallerUser(request)
+	principal := services.Principal(connectionId, userId)
+
+	call, err := db.GetCall(ctx, requestBody.CallId)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "removeReaction", err)
+	}
+
+	if !call.HasConnection(connectionId) {
+		return services.RespondError(ctx, request, "removeReaction", services.NotInCall(call, connectionId))
+	}
+
+	message, err := messages.RemoveReaction(ctx, services.Message{CallId: requestBody.CallId, MessageId: requestBody.MessageId}, requestBody.Emoji, principal)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "removeReaction", err)
+	}
+
+	api.PostToConnections(ctx, call.ConnectionIds(connectionId), services.NewEnvelope("reactionUpdated", map[string]any{
+		"call_id":    requestBody.CallId,
+		"message_id": requestBody.MessageId,
+		"emoji":      requestBody.Emoji,
+		"count":      len(message.Reactions[requestBody.Emoji]),
+		"principal":  principal,
+		"added":      false,
+	}))
+
+	return services.Respond(ctx, request, "removeReaction", message.ForPrincipal(principal))
+}
+
+func main() {
+	lambda.Start(services.Validated("removeReaction", handler))
+}
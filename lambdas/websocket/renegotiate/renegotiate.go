@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	dyscordconfig "dyscord-backend/config"
+	"dyscord-backend/lambdas/services"
+)
+
+type Request struct {
+	CallId string `json:"call_id"`
+}
+
+var (
+	db services.CallDatabase
+)
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		fmt.Println("Error loading config")
+	}
+	db = services.CallDatabase{
+		Client:    dynamodb.NewFromConfig(cfg),
+		TableName: dyscordconfig.TABLENAME,
+	}
+}
+
+// handler starts a new negotiation for the caller. The update stream tells the
+// other participants its new negotiation id, and the caller then sends each of
+// them a fresh offer through signal, which tags it with that id. No offer goes
+// through here: every peer connection needs its own.
+func handler(ctx context.Context, request events.APIGatewayWebsocketProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var requestBody Request
+
+	if err := json.Unmarshal([]byte(request.Body), &requestBody); err != nil {
+		return services.RespondError(ctx, request, "renegotiate", services.ErrInvalidBody)
+	}
+
+	connectionId, err := services.CallerConnectionId(request)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "renegotiate", err)
+	}
+
+	call, err := db.GetCall(ctx, requestBody.CallId)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "renegotiate", err)
+	}
+
+	if !call.HasConnection(connectionId) {
+		return services.RespondError(ctx, request, "renegotiate", services.NotInCall(call, connectionId))
+	}
+
+	sdp, err := db.Renegotiate(ctx, call, connectionId)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "renegotiate", err)
+	}
+
+	return services.Respond(ctx, request, "renegotiate", map[string]any{
+		"call_id":        requestBody.CallId,
+		"negotiation_id": sdp.NegotiationId,
+	})
+}
+
+func main() {
+	lambda.Start(services.Validated("renegotiate", handler))
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	dyscordconfig "dyscord-backend/config"
+	"dyscord-backend/lambdas/services"
+)
+
+type Request struct {
+	CallId      string `json:"call_id"`
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+var (
+	db      services.CallDatabase
+	uploads services.UploadStore
+)
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		fmt.Println("Error loading config")
+	}
+	db = services.CallDatabase{
+		Client:    dynamodb.NewFromConfig(cfg),
+		TableName: dyscordconfig.TABLENAME,
+	}
+	uploads = services.NewUploadStore(cfg, os.Getenv("UPLOAD_BUCKET"))
+}
+
+// handler returns a URL the client PUTs the file to before sending a message
+// with the returned attachment.
+func handler(ctx context.Context, request events.APIGatewayWebsocketProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var requestBody Request
+
+	if err := json.Unmarshal([]byte(request.Body), &requestBody); err != nil {
+		return services.RespondError(ctx, request, "requestUpload", services.ErrInvalidBody)
+	}
+
+	if err := services.ValidateUpload(requestBody.ContentType, requestBody.Size); err != nil {
+		return services.RespondError(ctx, request, "requestUpload", err)
+	}
+
+	connectionId, err := services.CallerConnectionId(request)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "requestUpload", err)
+	}
+
+	call, err := db.GetCall(ctx, requestBody.CallId)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "requestUpload", err)
+	}
+
+	if !call.HasConnection(connectionId) {
+		return services.RespondError(ctx, request, "requestUpload", services.NotInCall(call, connectionId))
+	}
+
+	attachment, url, err := uploads.PresignUpload(ctx, requestBody.CallId, requestBody.Name, requestBody.ContentType, requestBody.Size)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "requestUpload", err)
+	}
+
+	return services.Respond(ctx, request, "requestUpload", map[string]any{
+		"attachment": attachment,
+		"upload_url": url,
+		"headers": map[string]string{
+			"Content-Type": requestBody.ContentType,
+		},
+		"expires_at": time.Now().Add(services.UploadURLExpiry).UnixMilli(),
+	})
+}
+
+func main() {
+	lambda.Start(services.Validated("requestUpload", handler))
+}
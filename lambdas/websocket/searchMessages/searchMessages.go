@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	dyscordconfig "dyscord-backend/config"
+	"dyscord-backend/lambdas/services"
+)
+
+type Request struct {
+	Query  string `json:"query"`
+	CallId string `json:"call_id"`
+	Author string `json:"author"`
+	From   int64  `json:"from"`
+	To     int64  `json:"to"`
+	Before string `json:"before"`
+	Limit  int    `json:"limit"`
+}
+
+var (
+	connections services.ConnectionDatabase
+	search      services.SearchIndex
+	uploads     services.UploadStore
+)
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		fmt.Println("Error loading config")
+	}
+	client := dynamodb.NewFromConfig(cfg)
+	connections = services.ConnectionDatabase{
+		Client:    client,
+		TableName: dyscordconfig.CONNECTIONS_TABLENAME,
+	}
+	search = services.DynamoSearchIndex{
+		Client:    client,
+		TableName: dyscordconfig.SEARCH_TABLENAME,
+		Messages: services.MessageDatabase{
+			Client:    client,
+			TableName: dyscordconfig.MESSAGES_TABLENAME,
+		},
+	}
+	uploads = services.NewUploadStore(cfg, os.Getenv("UPLOAD_BUCKET"))
+}
+
+// handler searches the calls the caller's connection is in, or only the one
+// given in the request.
+func handler(ctx context.Context, request events.APIGatewayWebsocketProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var requestBody Request
+
+	if err := json.Unmarshal([]byte(request.Body), &requestBody); err != nil {
+		return services.RespondError(ctx, request, "searchMessages", services.ErrInvalidBody)
+	}
+
+	connectionId, err := services.CallerConnectionId(request)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "searchMessages", err)
+	}
+
+	userId, _ := services.CallerUser(request)
+
+	connection, err := connections.GetConnection(ctx, connectionId)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "searchMessages", err)
+	}
+
+	callIds := connection.CallIds
+	if requestBody.CallId != "" {
+		if !slices.Contains(callIds, requestBody.CallId) {
+			return services.RespondError(ctx, request, "searchMessages", services.Errorf(services.NotParticipant, "Connection %v is not in the call %v", connectionId, requestBody.CallId))
+		}
+		callIds = []string{requestBody.CallId}
+	}
+
+	page, err := search.Search(ctx, services.SearchQuery{
+		CallIds: callIds,
+		Text:    requestBody.Query,
+		Author:  requestBody.Author,
+		From:    requestBody.From,
+		To:      requestBody.To,
+		Before:  requestBody.Before,
+		Limit:   requestBody.Limit,
+	})
+
+	if err != nil {
+		return services.RespondError(ctx, request, "searchMessages", err)
+	}
+
+	if err = uploads.WithDownloadURLs(ctx, page.Messages()); err != nil {
+		return services.RespondError(ctx, request, "searchMessages", err)
+	}
+
+	return services.Respond(ctx, request, "searchMessages", page.ForPrincipal(services.Principal(connectionId, userId)))
+}
+
+func main() {
+	lambda.Start(services.Validated("searchMessages", handler))
+}
@@ -1,33 +1,153 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	dyscordconfig "dyscord-backend/config"
+	"dyscord-backend/lambdas/services"
 )
 
-// we need to post to connection with connectionId
+type Request struct {
+	CallId      string `json:"call_id"`
+	Text        string `json:"text"`
+	ClientMsgId string `json:"client_msg_id"`
+	ParentId    string `json:"parent_id"`
 
-func handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	Attachments []services.Attachment `json:"attachments"`
+}
 
-	responseBody, err := json.Marshal(map[string]string{
-		"message": "Hello World!",
-	})
+var (
+	db       services.CallDatabase
+	messages services.MessageDatabase
+	search   services.SearchIndex
+	uploads  services.UploadStore
+	api      services.APIGatewayManagementClient
+)
 
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
 	if err != nil {
-		return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Internal Sever Error"}, nil
+		fmt.Println("Error loading config")
+	}
+	client := dynamodb.NewFromConfig(cfg)
+	db = services.CallDatabase{
+		Client:    client,
+		TableName: dyscordconfig.TABLENAME,
+	}
+	messages = services.MessageDatabase{
+		Client:    client,
+		TableName: dyscordconfig.MESSAGES_TABLENAME,
+	}
+	search = services.DynamoSearchIndex{
+		Client:    client,
+		TableName: dyscordconfig.SEARCH_TABLENAME,
+		Messages:  messages,
 	}
+	uploads = services.NewUploadStore(cfg, os.Getenv("UPLOAD_BUCKET"))
+	api = services.NewAPIGatewayManagementClient(cfg, client)
+}
+
+func handler(ctx context.Context, request events.APIGatewayWebsocketProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var requestBody Request
+
+	if err := json.Unmarshal([]byte(request.Body), &requestBody); err != nil {
+		return services.RespondError(ctx, request, "sendMessage", services.ErrInvalidBody)
+	}
+
+	if len(requestBody.Text) > services.MaxMessageLength || (strings.TrimSpace(requestBody.Text) == "" && len(requestBody.Attachments) == 0) {
+		return services.RespondError(ctx, request, "sendMessage", services.Errorf(services.InvalidRequest, "Message text must be between 1 and %v characters", services.MaxMessageLength))
+	}
+
+	if len(requestBody.Attachments) > services.MaxAttachments {
+		return services.RespondError(ctx, request, "sendMessage", services.Errorf(services.InvalidRequest, "Messages can have at most %v attachments", services.MaxAttachments))
+	}
+
+	connectionId, err := services.CallerConnectionId(request)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "sendMessage", err)
+	}
+
+	userId, displayName := services.CallerUser(request)
+
+	call, err := db.GetCall(ctx, requestBody.CallId)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "sendMessage", err)
+	}
+
+	if !call.HasConnection(connectionId) {
+		return services.RespondError(ctx, request, "sendMessage", services.NotInCall(call, connectionId))
+	}
+
+	attachments := []services.Attachment{}
+	for _, attachment := range requestBody.Attachments {
+		attachment, err = uploads.VerifyAttachment(ctx, requestBody.CallId, attachment)
+
+		if err != nil {
+			return services.RespondError(ctx, request, "sendMessage", err)
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	now := time.Now()
+	message := services.Message{
+		CallId:       requestBody.CallId,
+		MessageId:    services.NewMessageId(now),
+		ClientMsgId:  requestBody.ClientMsgId,
+		ParentId:     requestBody.ParentId,
+		ConnectionId: connectionId,
+		UserId:       userId,
+		DisplayName:  displayName,
+		Text:         requestBody.Text,
+		Attachments:  attachments,
+		CreatedAt:    now.UnixMilli(),
+		TTL:          call.TTL,
+	}
+
+	var parent services.Message
+	if requestBody.ParentId != "" {
+		parent, err = messages.CreateReply(ctx, message, now)
+	} else {
+		err = messages.CreateMessage(ctx, message)
+	}
+
+	if err != nil {
+		return services.RespondError(ctx, request, "sendMessage", err)
+	}
+
+	// the message is stored either way, failing to index it only hides it
+	// from search
+	search.Index(ctx, message)
+
+	if err = uploads.WithDownloadURLs(ctx, []services.Message{message}); err != nil {
+		return services.RespondError(ctx, request, "sendMessage", err)
+	}
+
+	if parent.ReplyCount > 0 {
+		api.PostToConnections(ctx, call.ConnectionIds(connectionId), services.NewEnvelope("threadUpdated", map[string]any{
+			"call_id":       requestBody.CallId,
+			"message_id":    parent.MessageId,
+			"reply_count":   parent.ReplyCount,
+			"last_reply_at": parent.LastReplyAt,
+		}))
+	}
+
+	api.PostToConnections(ctx, call.ConnectionIds(connectionId), services.NewEnvelope("message", message))
 
-	return events.APIGatewayProxyResponse{
-		StatusCode: 200,
-		Headers: map[string]string{
-			"Content-Type": "application/json",
-		},
-		Body: string(responseBody),
-	}, nil
+	return services.Respond(ctx, request, "sendMessage", message)
 }
 
 func main() {
-	lambda.Start(handler)
+	lambda.Start(services.Validated("sendMessage", handler))
 }
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	dyscordconfig "dyscord-backend/config"
+	"dyscord-backend/lambdas/services"
+)
+
+type Request struct {
+	CallId                     string `json:"call_id"`
+	TargetConnectionId         string `json:"target_connection_id"`
+	Type                       string `json:"type"`
+	SessionDescriptionProtocol string `json:"sdp"`
+	NegotiationId              int64  `json:"negotiation_id"`
+}
+
+var (
+	db  services.CallDatabase
+	api services.APIGatewayManagementClient
+)
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		fmt.Println("Error loading config")
+	}
+	client := dynamodb.NewFromConfig(cfg)
+	db = services.CallDatabase{
+		Client:    client,
+		TableName: dyscordconfig.TABLENAME,
+	}
+	api = services.NewAPIGatewayManagementClient(cfg, client)
+}
+
+func handler(ctx context.Context, request events.APIGatewayWebsocketProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var requestBody Request
+
+	if err := json.Unmarshal([]byte(request.Body), &requestBody); err != nil {
+		return services.RespondError(ctx, request, "signal", services.ErrInvalidBody)
+	}
+
+	if !services.IsSignalType(requestBody.Type) {
+		return services.RespondError(ctx, request, "signal", services.Errorf(services.InvalidRequest, "Unsupported signal type %v", requestBody.Type))
+	}
+
+	connectionId, err := services.CallerConnectionId(request)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "signal", err)
+	}
+
+	call, err := db.GetCall(ctx, requestBody.CallId)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "signal", err)
+	}
+
+	if !call.HasConnection(connectionId) {
+		return services.RespondError(ctx, request, "signal", services.NotInCall(call, connectionId))
+	}
+
+	target, _, found := call.GetSDP(requestBody.TargetConnectionId)
+	if requestBody.TargetConnectionId == connectionId || !found {
+		return services.RespondError(ctx, request, "signal", services.Errorf(services.NotParticipant, "Connection %v is not a peer in the call %v", requestBody.TargetConnectionId, requestBody.CallId))
+	}
+
+	userId, displayName := services.CallerUser(request)
+
+	// offers carry the sender's current negotiation, answers must answer the
+	// target's current one or they are stale
+	negotiationId := requestBody.NegotiationId
+	if requestBody.Type == "offer" {
+		sender, _, _ := call.GetSDP(connectionId)
+		negotiationId = sender.NegotiationId
+	} else if negotiationId < target.NegotiationId {
+		return services.RespondError(ctx, request, "signal", services.Errorf(services.Conflict, "Answer to negotiation %v is stale, %v is at negotiation %v", negotiationId, requestBody.TargetConnectionId, target.NegotiationId))
+	}
+
+	api.PostToConnection(ctx, requestBody.TargetConnectionId, services.NewEnvelope("signal", services.Signal{
+		CallId:                     requestBody.CallId,
+		From:                       connectionId,
+		To:                         requestBody.TargetConnectionId,
+		Type:                       requestBody.Type,
+		SessionDescriptionProtocol: requestBody.SessionDescriptionProtocol,
+		NegotiationId:              negotiationId,
+		UserId:                     userId,
+		DisplayName:                displayName,
+	}))
+
+	return services.Respond(ctx, request, "signal", map[string]string{
+		"call_id":              requestBody.CallId,
+		"type":                 requestBody.Type,
+		"target_connection_id": requestBody.TargetConnectionId,
+	})
+}
+
+func main() {
+	lambda.Start(services.Validated("signal", handler))
+}
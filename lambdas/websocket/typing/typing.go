@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	dyscordconfig "dyscord-backend/config"
+	"dyscord-backend/lambdas/services"
+)
+
+type Request struct {
+	CallId string `json:"call_id"`
+}
+
+var (
+	db          services.CallDatabase
+	connections services.ConnectionDatabase
+	api         services.APIGatewayManagementClient
+)
+
+func init() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		fmt.Println("Error loading config")
+	}
+	client := dynamodb.NewFromConfig(cfg)
+	db = services.CallDatabase{
+		Client:    client,
+		TableName: dyscordconfig.TABLENAME,
+	}
+	connections = services.ConnectionDatabase{
+		Client:    client,
+		TableName: dyscordconfig.CONNECTIONS_TABLENAME,
+	}
+	api = services.NewAPIGatewayManagementClient(cfg, client)
+}
+
+func handler(ctx context.Context, request events.APIGatewayWebsocketProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var requestBody Request
+
+	if err := json.Unmarshal([]byte(request.Body), &requestBody); err != nil {
+		return services.RespondError(ctx, request, "typing", services.ErrInvalidBody)
+	}
+
+	connectionId, err := services.CallerConnectionId(request)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "typing", err)
+	}
+
+	userId, displayName := services.CallerUser(request)
+
+	call, err := db.GetCall(ctx, requestBody.CallId)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "typing", err)
+	}
+
+	if !call.HasConnection(connectionId) {
+		return services.RespondError(ctx, request, "typing", services.NotInCall(call, connectionId))
+	}
+
+	now := time.Now()
+	broadcast, err := connections.Typing(ctx, connectionId, requestBody.CallId, now)
+
+	if err != nil {
+		return services.RespondError(ctx, request, "typing", err)
+	}
+
+	if broadcast {
+		api.PostToConnections(ctx, call.ConnectionIds(connectionId), services.NewEnvelope("typing", map[string]any{
+			"call_id":       requestBody.CallId,
+			"connection_id": connectionId,
+			"user_id":       userId,
+			"display_name":  displayName,
+			"expires_at":    now.Add(2 * services.TypingWindow).UnixMilli(),
+		}))
+	}
+
+	return services.Respond(ctx, request, "typing", map[string]bool{
+		"broadcast": broadcast,
+	})
+}
+
+func main() {
+	lambda.Start(services.Validated("typing", handler))
+}
@@ -2,17 +2,16 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"os"
+	"slices"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
-	"github.com/aws/aws-sdk-go-v2/service/apigatewaymanagementapi"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 
 	"dyscord-backend/lambdas/services"
 )
@@ -23,15 +22,13 @@ var (
 
 func init() {
 	cfg, err := config.LoadDefaultConfig(context.TODO())
-	cfg.BaseEndpoint = aws.String(os.Getenv("AWS_ENDPOINT"))
 	cfg.Region = "us-east-2"
 
 	if err != nil {
 		fmt.Println("Error loading config")
 	}
-	api = services.APIGatewayManagementClient{
-		Client: apigatewaymanagementapi.NewFromConfig(cfg),
-	}
+	client := dynamodb.NewFromConfig(cfg)
+	api = services.NewAPIGatewayManagementClient(cfg, client)
 }
 
 // UnmarshalStreamImage converts events.DynamoDBAttributeValue to struct
@@ -84,49 +81,148 @@ func extractVal(v events.DynamoDBAttributeValue) interface{} {
 	return val
 }
 
-func handler(ctx context.Context, request events.DynamoDBEvent) error {
+// callImage converts an image of a call from the stream.
+func callImage(image map[string]events.DynamoDBAttributeValue) (services.Call, error) {
 	var call services.Call
+
+	attributes, err := UnmarshalStreamImage(image)
+	if err != nil {
+		return call, err
+	}
+	item, err := attributevalue.MarshalMap(attributes)
+	if err != nil {
+		return call, err
+	}
+	err = attributevalue.UnmarshalMap(item, &call)
+	return call, err
+}
+
+// handler tells clients about the calls in the stream: the creator of a new
+// call, the participants of a modified call about what changed, and whoever
+// is left in a deleted call why it ended. A record that could not be
+// delivered is reported as failed, the stream is retried from there on so
+// the records after it are left for the retry.
+func handler(ctx context.Context, request events.DynamoDBEvent) (events.DynamoDBEventResponse, error) {
+	response := events.DynamoDBEventResponse{BatchItemFailures: []events.DynamoDBBatchItemFailure{}}
 	for _, record := range request.Records {
-		if record.EventName == "MODIFY" && record.Change.StreamViewType == "NEW_IMAGE" {
-			newImage, err := UnmarshalStreamImage(record.Change.NewImage)
-			if err != nil {
-				log.Println(err.Error())
-			}
-			for k, v := range newImage {
-				log.Println(k, v)
-			}
-			newerImage, err := attributevalue.MarshalMap(newImage)
-			if err != nil {
-				log.Println(err.Error())
-			}
-
-			attributevalue.UnmarshalMap(newerImage, &call)
-
-			connectionIds := make([]string, len(call.ConnectionSdps))
-			values := make([]interface{}, len(call.ConnectionSdps))
-			for index, sdp := range call.ConnectionSdps {
-				connectionIds[index] = sdp.ConnectionId
-				values[index] = struct {
-					Type                       string `dynamodbav:"type" json:"type"`
-					SessionDescriptionProtocol string `dynamodbav:"sdp" json:"sdp"`
-				}{
-					Type:                       sdp.Type,
-					SessionDescriptionProtocol: sdp.SessionDescriptionProtocol,
-				}
-			}
-
-			value, err := json.Marshal(map[string]any{
-				"action": "update",
-				"data":   values,
-			})
+		if record.Change.StreamViewType != "NEW_AND_OLD_IMAGES" {
+			continue
+		}
 
-			if err != nil {
-				log.Println("Could not marshal connection sdps")
-			}
-			api.PostToConnections(ctx, connectionIds, value)
+		var err error
+		switch record.EventName {
+		case "INSERT":
+			err = created(ctx, record)
+		case "MODIFY":
+			err = modified(ctx, record)
+		case "REMOVE":
+			err = removed(ctx, record)
 		}
+
+		if err != nil {
+			log.Printf("Could not deliver record %v, %v", record.Change.SequenceNumber, err)
+			response.BatchItemFailures = append(response.BatchItemFailures, events.DynamoDBBatchItemFailure{
+				ItemIdentifier: record.Change.SequenceNumber,
+			})
+			break
+		}
+	}
+	return response, nil
+}
+
+// created lets the connection that created a call know it is ready.
+func created(ctx context.Context, record events.DynamoDBEventRecord) error {
+	call, err := callImage(record.Change.NewImage)
+	if err != nil {
+		log.Printf("Could not unmarshal new image, %v", err)
+		return nil
+	}
+	if call.CreatedBy == "" {
+		return nil
+	}
+
+	return api.PostToConnections(ctx, []string{call.CreatedBy}, services.NewEnvelope(services.CallCreated, services.CallEvent{
+		CallId:    call.CallId,
+		ExpiresAt: call.TTL,
+	})).Err()
+}
+
+// modified diffs the participants of the call and only tells the others what
+// changed. A participant that joined is sent its peers once, to offer to
+// each of them through signal.
+func modified(ctx context.Context, record events.DynamoDBEventRecord) error {
+	oldCall, err := callImage(record.Change.OldImage)
+	if err != nil {
+		log.Printf("Could not unmarshal old image, %v", err)
+		return nil
+	}
+	newCall, err := callImage(record.Change.NewImage)
+	if err != nil {
+		log.Printf("Could not unmarshal new image, %v", err)
+		return nil
+	}
+
+	diff := services.DiffParticipants(oldCall, newCall)
+	if diff.Empty() {
+		return nil
 	}
-	return nil
+	reports := []services.DeliveryReport{}
+
+	for _, sdp := range diff.Left {
+		reports = append(reports, api.PostToConnections(ctx, newCall.ConnectionIds(), services.NewEnvelope(services.ParticipantLeft, services.ParticipantEvent{
+			CallId:       newCall.CallId,
+			ConnectionId: sdp.ConnectionId,
+		})))
+	}
+
+	for _, sdp := range diff.Joined {
+		reports = append(reports, api.PostToConnections(ctx, []string{sdp.ConnectionId}, services.NewEnvelope("peers", map[string]any{
+			"call_id": newCall.CallId,
+			"peers":   newCall.PeersOf(sdp.ConnectionId),
+		})))
+		peer := sdp.Peer()
+		reports = append(reports, api.PostToConnections(ctx, newCall.ConnectionIds(sdp.ConnectionId), services.NewEnvelope(services.ParticipantJoined, services.ParticipantEvent{
+			CallId:       newCall.CallId,
+			ConnectionId: sdp.ConnectionId,
+			Participant:  &peer,
+		})))
+	}
+
+	for _, sdp := range diff.Updated {
+		peer := sdp.Peer()
+		reports = append(reports, api.PostToConnections(ctx, newCall.ConnectionIds(sdp.ConnectionId), services.NewEnvelope(services.ParticipantUpdated, services.ParticipantEvent{
+			CallId:       newCall.CallId,
+			ConnectionId: sdp.ConnectionId,
+			Participant:  &peer,
+		})))
+	}
+
+	errs := []error{}
+	for _, report := range reports {
+		errs = append(errs, report.Err())
+	}
+	return errors.Join(errs...)
+}
+
+// removed tells the participants still in the call, and its creator, that it
+// ended and why.
+func removed(ctx context.Context, record events.DynamoDBEventRecord) error {
+	call, err := callImage(record.Change.OldImage)
+	if err != nil {
+		log.Printf("Could not unmarshal old image, %v", err)
+		return nil
+	}
+
+	connectionIds := call.ConnectionIds()
+	if call.CreatedBy != "" && !slices.Contains(connectionIds, call.CreatedBy) {
+		connectionIds = append(connectionIds, call.CreatedBy)
+	}
+
+	return api.PostToConnections(ctx, connectionIds, services.NewEnvelope(services.CallEnded, services.CallEvent{
+		CallId:  call.CallId,
+		Reason:  services.EndReason(record, call),
+		EndedBy: call.EndedBy,
+	})).Err()
 }
 
 func main() {
@@ -0,0 +1,26 @@
+// Package schemas holds the JSON Schema of the body of every action clients
+// can send. The schemas are plain files so clients can generate their types
+// from them, common.json holds the definitions the others refer to.
+package schemas
+
+import (
+	"embed"
+	"strings"
+)
+
+//go:embed *.json
+var FS embed.FS
+
+const Common = "common.json"
+
+// Actions lists the actions that have a schema.
+func Actions() []string {
+	actions := []string{}
+	entries, _ := FS.ReadDir(".")
+	for _, entry := range entries {
+		if entry.Name() != Common {
+			actions = append(actions, strings.TrimSuffix(entry.Name(), ".json"))
+		}
+	}
+	return actions
+}
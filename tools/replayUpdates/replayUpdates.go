@@ -0,0 +1,273 @@
+// replayUpdates replays the stream batches the update handler gave up on.
+// Lambda only sends the position of a failed batch to the dead letter queue,
+// so the records are read back from the stream, which keeps them for 24
+// hours, and sent to the update function again. Messages are deleted from the
+// queue once their batch was delivered.
+//
+//	go run ./tools/replayUpdates -queue <UpdatesDeadLetterQueueUrl> -function <UpdateFunctionName>
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// maxEmptyPages is how many empty pages of an open shard are read before
+// giving up on the rest of a batch.
+const maxEmptyPages = 5
+
+// Failure is the message Lambda sends to the on-failure destination of a
+// DynamoDB event source.
+type Failure struct {
+	BatchInfo struct {
+		ShardId             string `json:"shardId"`
+		StartSequenceNumber string `json:"startSequenceNumber"`
+		EndSequenceNumber   string `json:"endSequenceNumber"`
+		StreamArn           string `json:"streamArn"`
+	} `json:"DDBStreamBatchInfo"`
+}
+
+var (
+	streams   *dynamodbstreams.Client
+	functions *lambda.Client
+	queue     *sqs.Client
+)
+
+func main() {
+	queueUrl := flag.String("queue", "", "url of the dead letter queue of the update handler")
+	functionName := flag.String("function", "", "name of the update function")
+	dryRun := flag.Bool("dry-run", false, "only print the records that would be replayed")
+	flag.Parse()
+
+	if *queueUrl == "" || *functionName == "" {
+		flag.Usage()
+		return
+	}
+
+	ctx := context.Background()
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		log.Fatalf("Error loading config, %v", err)
+	}
+	streams = dynamodbstreams.NewFromConfig(cfg)
+	functions = lambda.NewFromConfig(cfg)
+	queue = sqs.NewFromConfig(cfg)
+
+	replayed, failed := 0, 0
+	for {
+		response, err := queue.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            queueUrl,
+			MaxNumberOfMessages: 10,
+			WaitTimeSeconds:     1,
+		})
+		if err != nil {
+			log.Fatalf("Could not receive messages, %v", err)
+		}
+		if len(response.Messages) == 0 {
+			break
+		}
+
+		for _, message := range response.Messages {
+			if err = replay(ctx, aws.ToString(message.Body), *functionName, *dryRun); err != nil {
+				log.Printf("Could not replay %v, %v", aws.ToString(message.MessageId), err)
+				failed++
+				continue
+			}
+			replayed++
+
+			if *dryRun {
+				continue
+			}
+			_, err = queue.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+				QueueUrl:      queueUrl,
+				ReceiptHandle: message.ReceiptHandle,
+			})
+			if err != nil {
+				log.Printf("Could not delete %v, %v", aws.ToString(message.MessageId), err)
+			}
+		}
+	}
+
+	fmt.Printf("replayed %v batches, %v failed\n", replayed, failed)
+}
+
+// replay reads the batch of a failure message back from the stream and sends
+// it to the update function.
+func replay(ctx context.Context, body string, functionName string, dryRun bool) error {
+	var failure Failure
+	if err := json.Unmarshal([]byte(body), &failure); err != nil {
+		return err
+	}
+
+	records, err := batch(ctx, failure)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return errors.New("the records of the batch are no longer in the stream")
+	}
+
+	event := events.DynamoDBEvent{}
+	for _, record := range records {
+		event.Records = append(event.Records, eventRecord(record, failure.BatchInfo.StreamArn))
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		fmt.Println(string(payload))
+		return nil
+	}
+
+	output, err := functions.Invoke(ctx, &lambda.InvokeInput{
+		FunctionName: aws.String(functionName),
+		Payload:      payload,
+	})
+	if err != nil {
+		return err
+	}
+	if output.FunctionError != nil {
+		return fmt.Errorf("%v, %v", aws.ToString(output.FunctionError), string(output.Payload))
+	}
+
+	var response events.DynamoDBEventResponse
+	if err = json.Unmarshal(output.Payload, &response); err != nil {
+		return err
+	}
+	if len(response.BatchItemFailures) > 0 {
+		return fmt.Errorf("record %v was not delivered", response.BatchItemFailures[0].ItemIdentifier)
+	}
+	return nil
+}
+
+// batch reads the records between the start and end sequence numbers of a
+// failed batch from its shard.
+func batch(ctx context.Context, failure Failure) ([]types.Record, error) {
+	info := failure.BatchInfo
+	end, ok := new(big.Int).SetString(info.EndSequenceNumber, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid sequence number %v", info.EndSequenceNumber)
+	}
+
+	iterator, err := streams.GetShardIterator(ctx, &dynamodbstreams.GetShardIteratorInput{
+		StreamArn:         aws.String(info.StreamArn),
+		ShardId:           aws.String(info.ShardId),
+		ShardIteratorType: types.ShardIteratorTypeAtSequenceNumber,
+		SequenceNumber:    aws.String(info.StartSequenceNumber),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	records := []types.Record{}
+	shardIterator := iterator.ShardIterator
+	for emptyPages := 0; shardIterator != nil && emptyPages < maxEmptyPages; {
+		response, err := streams.GetRecords(ctx, &dynamodbstreams.GetRecordsInput{
+			ShardIterator: shardIterator,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(response.Records) == 0 {
+			emptyPages++
+		}
+
+		for _, record := range response.Records {
+			sequenceNumber, _ := new(big.Int).SetString(aws.ToString(record.Dynamodb.SequenceNumber), 10)
+			if sequenceNumber == nil || sequenceNumber.Cmp(end) > 0 {
+				return records, nil
+			}
+			records = append(records, record)
+			if sequenceNumber.Cmp(end) == 0 {
+				return records, nil
+			}
+		}
+		shardIterator = response.NextShardIterator
+	}
+	return records, nil
+}
+
+// eventRecord converts a record of the stream into the record Lambda would
+// have invoked the update function with.
+func eventRecord(record types.Record, streamArn string) events.DynamoDBEventRecord {
+	eventRecord := events.DynamoDBEventRecord{
+		AWSRegion:      aws.ToString(record.AwsRegion),
+		EventID:        aws.ToString(record.EventID),
+		EventName:      string(record.EventName),
+		EventSource:    aws.ToString(record.EventSource),
+		EventVersion:   aws.ToString(record.EventVersion),
+		EventSourceArn: streamArn,
+		Change: events.DynamoDBStreamRecord{
+			Keys:           attributes(record.Dynamodb.Keys),
+			NewImage:       attributes(record.Dynamodb.NewImage),
+			OldImage:       attributes(record.Dynamodb.OldImage),
+			SequenceNumber: aws.ToString(record.Dynamodb.SequenceNumber),
+			SizeBytes:      aws.ToInt64(record.Dynamodb.SizeBytes),
+			StreamViewType: string(record.Dynamodb.StreamViewType),
+		},
+	}
+	if record.Dynamodb.ApproximateCreationDateTime != nil {
+		eventRecord.Change.ApproximateCreationDateTime = events.SecondsEpochTime{Time: *record.Dynamodb.ApproximateCreationDateTime}
+	}
+	if record.UserIdentity != nil {
+		eventRecord.UserIdentity = &events.DynamoDBUserIdentity{
+			Type:        aws.ToString(record.UserIdentity.Type),
+			PrincipalID: aws.ToString(record.UserIdentity.PrincipalId),
+		}
+	}
+	return eventRecord
+}
+
+func attributes(values map[string]types.AttributeValue) map[string]events.DynamoDBAttributeValue {
+	if values == nil {
+		return nil
+	}
+	converted := map[string]events.DynamoDBAttributeValue{}
+	for key, value := range values {
+		converted[key] = attribute(value)
+	}
+	return converted
+}
+
+func attribute(value types.AttributeValue) events.DynamoDBAttributeValue {
+	switch value := value.(type) {
+	case *types.AttributeValueMemberS:
+		return events.NewStringAttribute(value.Value)
+	case *types.AttributeValueMemberN:
+		return events.NewNumberAttribute(value.Value)
+	case *types.AttributeValueMemberB:
+		return events.NewBinaryAttribute(value.Value)
+	case *types.AttributeValueMemberBOOL:
+		return events.NewBooleanAttribute(value.Value)
+	case *types.AttributeValueMemberSS:
+		return events.NewStringSetAttribute(value.Value)
+	case *types.AttributeValueMemberNS:
+		return events.NewNumberSetAttribute(value.Value)
+	case *types.AttributeValueMemberBS:
+		return events.NewBinarySetAttribute(value.Value)
+	case *types.AttributeValueMemberL:
+		list := []events.DynamoDBAttributeValue{}
+		for _, item := range value.Value {
+			list = append(list, attribute(item))
+		}
+		return events.NewListAttribute(list)
+	case *types.AttributeValueMemberM:
+		return events.NewMapAttribute(attributes(value.Value))
+	}
+	return events.NewNullAttribute()
+}